@@ -17,6 +17,8 @@ var (
 	ComMissSid        = errorPair(90010, "sid缺失")
 	ComAuthExpired    = errorPair(90011, "鉴权已过期")
 	ComDataInvalid    = errorPair(90012, "数据非法")
+	ComTimeout        = errorPair(90013, "请求超时")
+	ComCanceled       = errorPair(90014, "请求已取消")
 )
 
 type (
@@ -0,0 +1,61 @@
+package httpmux
+
+import (
+	"aicode"
+	"logger"
+	"net/http"
+	"time"
+)
+
+// AccessLogConfig defines the config for AccessLog middleware.
+type AccessLogConfig struct {
+	// Logger receives the access log lines. Default is logger.GetInstance().
+	Logger *logger.Ailog
+}
+
+// AccessLog returns a middleware which writes one log line per request with
+// its method, route pattern, status, size, latency, client IP and aicode error
+// code. Requests answered with a 5xx status are logged as errors.
+//
+// Errors returned by the next handle are returned unchanged; the logged status
+// is the one StatusCode maps their code to. Panics are logged with status 500
+// and the code of aicode.ComInnerError before being passed on to the server
+// recovery. Use it after RequestID to log the request ID too.
+func AccessLog() Middleware {
+	return AccessLogWithConfig(AccessLogConfig{})
+}
+
+// AccessLogWithConfig returns an AccessLog middleware with config.
+func AccessLogWithConfig(config AccessLogConfig) Middleware {
+	if config.Logger == nil {
+		config.Logger = logger.GetInstance()
+	}
+	return func(next Handle) Handle {
+		return func(c Context) (err aicode.HTTPError) {
+			start := time.Now()
+			defer func() {
+				rc := recover()
+				status, code := outcome(c, err)
+				if rc != nil {
+					status, code = http.StatusInternalServerError, aicode.ComInnerError.Code()
+				}
+
+				req, rsp := c.Request(), c.Response()
+				format := "access id=%s method=%s path=%q route=%q status=%d size=%d latency=%s ip=%s code=%d"
+				args := []interface{}{
+					RequestIDFrom(c), req.Method, req.URL.Path, c.Path(), status, rsp.Size,
+					time.Since(start), c.RealIP(), code,
+				}
+				if status >= http.StatusInternalServerError {
+					config.Logger.Errorf(format, args...)
+				} else {
+					config.Logger.Infof(format, args...)
+				}
+				if rc != nil {
+					panic(rc)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
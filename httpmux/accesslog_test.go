@@ -0,0 +1,75 @@
+package httpmux
+
+import (
+	"aicode"
+	"bytes"
+	"fmt"
+	"logger"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_AccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	srv := New()
+	var passed aicode.HTTPError
+	srv.Use(func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			passed = next(c)
+			return passed
+		}
+	})
+	srv.Use(RequestID(), AccessLogWithConfig(AccessLogConfig{Logger: logger.NewLogger(buf)}))
+	srv.GET("/stream/:id", func(c Context) aicode.HTTPError {
+		return aicode.ComLimit
+	})
+	srv.GET("/handled", func(c Context) aicode.HTTPError {
+		c.Error(aicode.ComNotExist)
+		return nil
+	})
+	srv.GET("/panic", func(c Context) aicode.HTTPError {
+		panic("boom")
+	})
+
+	req := httptest.NewRequest(GET, "/stream/1", nil)
+	req.Header.Set(HeaderXRequestID, "req-1")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != 429 || rec.Header().Get(HeaderXRequestID) != "req-1" {
+		t.Errorf("status %d, request id %q", rec.Code, rec.Header().Get(HeaderXRequestID))
+	}
+	if passed != aicode.ComLimit {
+		t.Errorf("error returned to outer middleware %v", passed)
+	}
+	line := buf.String()
+	for _, want := range []string{"id=req-1", "method=GET", `route="/stream/:id"`, "status=429", "code=90007", "ip=192.0.2.1"} {
+		if !strings.Contains(line, want) {
+			t.Errorf("log line %q lacks %q", line, want)
+		}
+	}
+
+	buf.Reset()
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/handled", nil))
+	line = buf.String()
+	if rec.Code != 404 || !strings.Contains(line, "status=404") || !strings.Contains(line, fmt.Sprintf("code=%d", aicode.ComNotExist.Code())) {
+		t.Errorf("handled: status %d, log %q", rec.Code, line)
+	}
+
+	buf.Reset()
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/panic", nil))
+	line = buf.String()
+	if rec.Code != 500 || !strings.Contains(line, "status=500") || !strings.Contains(line, fmt.Sprintf("code=%d", aicode.ComInnerError.Code())) {
+		t.Errorf("panic: status %d, log %q", rec.Code, line)
+	}
+
+	req = httptest.NewRequest(GET, "/stream/1", nil)
+	req.Header.Set(HeaderXRequestID, "bad id\n")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if id := rec.Header().Get(HeaderXRequestID); len(id) != 32 {
+		t.Errorf("generated request id %q", id)
+	}
+}
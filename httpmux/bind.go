@@ -0,0 +1,275 @@
+package httpmux
+
+import (
+	"aicode"
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack"
+)
+
+type (
+	// Binder is the interface that wraps the Bind method.
+	Binder interface {
+		Bind(i interface{}, c Context) error
+	}
+
+	// BodyDecoder decodes the request body of c into i.
+	BodyDecoder func(c Context, i interface{}) error
+
+	// DefaultBinder binds path params, query params and headers through the
+	// `param`, `query` and `header` struct tags, then decodes the body with the
+	// decoder registered for its Content-Type.
+	DefaultBinder struct {
+		decoders map[string]BodyDecoder
+	}
+)
+
+// NewBinder creates a DefaultBinder with decoders for JSON, XML, form,
+// multipart form, msgpack and protobuf bodies.
+func NewBinder() *DefaultBinder {
+	b := &DefaultBinder{decoders: make(map[string]BodyDecoder)}
+	b.RegisterDecoder(MIMEApplicationJSON, decodeJSON)
+	b.RegisterDecoder(MIMEApplicationXML, decodeXML)
+	b.RegisterDecoder(MIMETextXML, decodeXML)
+	b.RegisterDecoder(MIMEApplicationForm, decodeForm)
+	b.RegisterDecoder(MIMEMultipartForm, decodeForm)
+	b.RegisterDecoder(MIMEApplicationMsgpack, decodeMsgpack)
+	b.RegisterDecoder(MIMEApplicationProtobuf, decodeProtobuf)
+	return b
+}
+
+// RegisterDecoder sets the body decoder for the media type, replacing any
+// decoder already registered for it.
+func (b *DefaultBinder) RegisterDecoder(mediaType string, d BodyDecoder) {
+	b.decoders[strings.ToLower(mediaType)] = d
+}
+
+// Bind implements the Binder interface. Requests without a Content-Type are
+// decoded as JSON. Failures are reported as aicode.ComBadParam with the
+// offending field in the message.
+func (b *DefaultBinder) Bind(i interface{}, c Context) error {
+	names, values := c.ParamNames(), c.ParamValues()
+	params := make(map[string][]string, len(names))
+	for n, name := range names {
+		params[name] = []string{values[n]}
+	}
+	if err := bindData(i, "param", func(name string) []string {
+		return params[name]
+	}); err != nil {
+		return err
+	}
+	query := c.QueryParams()
+	if err := bindData(i, "query", func(name string) []string {
+		return query[name]
+	}); err != nil {
+		return err
+	}
+	header := c.Request().Header
+	if err := bindData(i, "header", func(name string) []string {
+		return header[http.CanonicalHeaderKey(name)]
+	}); err != nil {
+		return err
+	}
+
+	req := c.Request()
+	if req.ContentLength == 0 || req.Body == nil || req.Body == http.NoBody {
+		return nil
+	}
+	mediaType := MIMEApplicationJSON
+	if ctype := req.Header.Get(HeaderContentType); ctype != "" {
+		mt, _, err := mime.ParseMediaType(ctype)
+		if err != nil {
+			return badParam("invalid Content-Type %q", ctype)
+		}
+		mediaType = mt
+	}
+	d, ok := b.decoders[mediaType]
+	if !ok {
+		return badParam("unsupported Content-Type %q", mediaType)
+	}
+	return d(c, i)
+}
+
+func badParam(format string, a ...interface{}) aicode.HTTPError {
+	return aicode.NewHTTPError(aicode.ComBadParam.Code(), aicode.ComBadParam.Msg()+": "+fmt.Sprintf(format, a...))
+}
+
+// decodeError turns a decoder error into an aicode error. Errors which already
+// are aicode errors, such as those returned by a limited request body, are
+// passed through.
+func decodeError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var he aicode.HTTPError
+	if errors.As(err, &he) {
+		return he
+	}
+	switch e := err.(type) {
+	case *json.UnmarshalTypeError:
+		return badParam("field %q: expected %v, got %s", e.Field, e.Type, e.Value)
+	case *json.SyntaxError:
+		return badParam("syntax error at offset %d: %v", e.Offset, e)
+	}
+	return badParam("%v", err)
+}
+
+func decodeJSON(c Context, i interface{}) error {
+	return decodeError(json.NewDecoder(c.Request().Body).Decode(i))
+}
+
+func decodeXML(c Context, i interface{}) error {
+	return decodeError(xml.NewDecoder(c.Request().Body).Decode(i))
+}
+
+func decodeMsgpack(c Context, i interface{}) error {
+	return decodeError(msgpack.NewDecoder(c.Request().Body).Decode(i))
+}
+
+func decodeProtobuf(c Context, i interface{}) error {
+	m, ok := i.(proto.Message)
+	if !ok {
+		return badParam("%T is not a protobuf message", i)
+	}
+	b, err := ioutil.ReadAll(c.Request().Body)
+	if err != nil {
+		return decodeError(err)
+	}
+	return decodeError(proto.Unmarshal(b, m))
+}
+
+// decodeForm binds form values by the `form` tag, falling back to the field
+// name for untagged fields.
+func decodeForm(c Context, i interface{}) error {
+	form, err := c.FormParams()
+	if err != nil {
+		return decodeError(err)
+	}
+	return bindData(i, "form", func(name string) []string {
+		return form[name]
+	})
+}
+
+var textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+
+// bindData sets the fields of the struct pointed to by ptr whose `tag` names a
+// value returned by lookup. Targets other than struct pointers are ignored.
+func bindData(ptr interface{}, tag string, lookup func(name string) []string) error {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil
+	}
+	v = v.Elem()
+	if v.Kind() != reflect.Struct {
+		return nil
+	}
+	return bindStruct(v, tag, lookup)
+}
+
+func bindStruct(v reflect.Value, tag string, lookup func(name string) []string) error {
+	t := v.Type()
+	for n := 0; n < t.NumField(); n++ {
+		field, fv := t.Field(n), v.Field(n)
+		if !fv.CanSet() {
+			continue
+		}
+		name := field.Tag.Get(tag)
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if fv.Kind() == reflect.Struct && !reflect.PtrTo(fv.Type()).Implements(textUnmarshalerType) {
+				if err := bindStruct(fv, tag, lookup); err != nil {
+					return err
+				}
+				continue
+			}
+			if tag != "form" {
+				continue
+			}
+			name = field.Name
+		}
+		values := lookup(name)
+		if len(values) == 0 {
+			continue
+		}
+		if err := setField(fv, values); err != nil {
+			return badParam("%s %q: %v", tag, name, err)
+		}
+	}
+	return nil
+}
+
+func setField(v reflect.Value, values []string) error {
+	if v.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return setField(v.Elem(), values)
+	}
+	if v.Kind() == reflect.Slice && v.Type().Elem().Kind() != reflect.Uint8 {
+		s := reflect.MakeSlice(v.Type(), len(values), len(values))
+		for n, value := range values {
+			if err := setValue(s.Index(n), value); err != nil {
+				return err
+			}
+		}
+		v.Set(s)
+		return nil
+	}
+	return setValue(v, values[0])
+}
+
+func setValue(v reflect.Value, s string) error {
+	if v.CanAddr() && v.Addr().Type().Implements(textUnmarshalerType) {
+		return v.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+	if s == "" && v.Kind() != reflect.String {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		v.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		i, err := strconv.ParseInt(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetInt(i)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		u, err := strconv.ParseUint(s, 10, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetUint(u)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, v.Type().Bits())
+		if err != nil {
+			return err
+		}
+		v.SetFloat(f)
+	case reflect.Slice:
+		v.SetBytes([]byte(s))
+	default:
+		return errors.New("unsupported type " + v.Type().String())
+	}
+	return nil
+}
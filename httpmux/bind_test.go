@@ -0,0 +1,79 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type bindBody struct {
+	ID      int      `param:"id"`
+	Tags    []string `query:"tag"`
+	Token   string   `header:"X-Token"`
+	Name    string   `json:"name" xml:"name" form:"name"`
+	Age     int      `json:"age" xml:"age" form:"age"`
+	Comment string
+}
+
+func bindRequest(t *testing.T, req *http.Request) (*bindBody, error) {
+	srv := New()
+	b := new(bindBody)
+	var err error
+	srv.POST("/user/:id", func(c Context) aicode.HTTPError {
+		err = c.Bind(b)
+		return nil
+	})
+	srv.ServeHTTP(httptest.NewRecorder(), req)
+	return b, err
+}
+
+func Test_BindContentType(t *testing.T) {
+	tests := []struct {
+		ctype string
+		body  string
+	}{
+		{"", `{"name":"ai","age":3}`},
+		{MIMEApplicationJSONCharsetUTF8, `{"name":"ai","age":3}`},
+		{MIMEApplicationXML, `<bindBody><name>ai</name><age>3</age></bindBody>`},
+		{MIMEApplicationForm, `name=ai&age=3`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(POST, "/user/7?tag=a&tag=b", strings.NewReader(tt.body))
+		if tt.ctype != "" {
+			req.Header.Set(HeaderContentType, tt.ctype)
+		}
+		req.Header.Set("X-Token", "tk")
+		b, err := bindRequest(t, req)
+		if err != nil {
+			t.Errorf("%q: %v", tt.ctype, err)
+			continue
+		}
+		if b.ID != 7 || strings.Join(b.Tags, ",") != "a,b" || b.Token != "tk" || b.Name != "ai" || b.Age != 3 {
+			t.Errorf("%q: bound %+v", tt.ctype, b)
+		}
+	}
+}
+
+func Test_BindError(t *testing.T) {
+	tests := []struct {
+		target string
+		ctype  string
+		body   string
+		detail string
+	}{
+		{"/user/x", MIMEApplicationJSON, `{}`, `param "id"`},
+		{"/user/1", MIMEApplicationJSON, `{"age":"old"}`, `field "age"`},
+		{"/user/1", "application/yaml", `age: 1`, `unsupported Content-Type`},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(POST, tt.target, strings.NewReader(tt.body))
+		req.Header.Set(HeaderContentType, tt.ctype)
+		_, err := bindRequest(t, req)
+		he, ok := err.(aicode.HTTPError)
+		if !ok || he.Code() != aicode.ComBadParam.Code() || !strings.Contains(he.Msg(), tt.detail) {
+			t.Errorf("%s %s: got %v, want detail %q", tt.target, tt.ctype, err, tt.detail)
+		}
+	}
+}
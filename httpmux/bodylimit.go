@@ -0,0 +1,132 @@
+package httpmux
+
+import (
+	"aicode"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+type (
+	// BodyLimitConfig defines the config for BodyLimit middleware.
+	BodyLimitConfig struct {
+		// Limit is the maximum body size, e.g. "512KB" or "2MB". Units are B,
+		// KB, MB and GB, based on 1024.
+		Limit string
+
+		// Overrides maps route patterns, as returned by Context.Path, to the
+		// limit applied instead of Limit.
+		Overrides map[string]string
+	}
+
+	// limitedBody fails with aicode.ComEntityTooLarge once more than limit
+	// bytes were read.
+	limitedBody struct {
+		io.ReadCloser
+		limit int64
+		read  int64
+	}
+)
+
+// BodyLimit returns a middleware which limits the request body size. See
+// BodyLimitWithConfig.
+func BodyLimit(limit string) Middleware {
+	return BodyLimitWithConfig(BodyLimitConfig{Limit: limit})
+}
+
+// BodyLimitWithConfig returns a BodyLimit middleware with config. It panics if
+// a limit can't be parsed.
+//
+// Requests whose Content-Length exceeds the limit are rejected with
+// aicode.ComEntityTooLarge before the next handle runs. Chunked bodies fail
+// with the same error while being read, e.g. by Context.Bind.
+//
+// When a server-wide BodyLimit is installed with server.Use, a BodyLimit
+// passed to a route replaces its limit; raising the limit of a route needs
+// an entry in Overrides, since Content-Length is checked by the server-wide
+// one first.
+func BodyLimitWithConfig(config BodyLimitConfig) Middleware {
+	limit := mustParseBytes(config.Limit)
+	overrides := make(map[string]int64, len(config.Overrides))
+	for route, l := range config.Overrides {
+		overrides[route] = mustParseBytes(l)
+	}
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			max := limit
+			if l, ok := overrides[c.Path()]; ok {
+				max = l
+			}
+			req := c.Request()
+			if req.ContentLength > max {
+				return aicode.ComEntityTooLarge
+			}
+			if lb, ok := req.Body.(*limitedBody); ok {
+				lb.limit = max
+			} else if req.Body != nil {
+				req.Body = &limitedBody{ReadCloser: req.Body, limit: max}
+			}
+			return next(c)
+		}
+	}
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	if b.read > b.limit {
+		return 0, aicode.ComEntityTooLarge
+	}
+	// read one byte more than allowed to tell a body of exactly limit bytes
+	// from a larger one
+	if left := b.limit - b.read + 1; int64(len(p)) > left {
+		p = p[:left]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.read += int64(n)
+	if b.read > b.limit {
+		return n - int(b.read-b.limit), aicode.ComEntityTooLarge
+	}
+	return n, err
+}
+
+// bodyLimit returns the limit installed by BodyLimit on the request body, or
+// -1 if there is none.
+func bodyLimit(body io.ReadCloser) int64 {
+	if lb, ok := body.(*limitedBody); ok {
+		return lb.limit
+	}
+	return -1
+}
+
+func mustParseBytes(s string) int64 {
+	n, err := parseBytes(s)
+	if err != nil {
+		panic(err)
+	}
+	return n
+}
+
+// parseBytes parses sizes such as "100", "512KB", "2MB" or "1G".
+func parseBytes(s string) (int64, error) {
+	v := strings.ToUpper(strings.TrimSpace(s))
+	v = strings.TrimSuffix(v, "B")
+	unit := int64(1)
+	if v != "" {
+		switch v[len(v)-1] {
+		case 'K':
+			unit = 1 << 10
+		case 'M':
+			unit = 1 << 20
+		case 'G':
+			unit = 1 << 30
+		}
+		if unit > 1 {
+			v = v[:len(v)-1]
+		}
+	}
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid body limit %q", s)
+	}
+	return n * unit, nil
+}
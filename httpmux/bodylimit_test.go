@@ -0,0 +1,63 @@
+package httpmux
+
+import (
+	"aicode"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_BodyLimit(t *testing.T) {
+	srv := New()
+	srv.Use(BodyLimitWithConfig(BodyLimitConfig{Limit: "1KB", Overrides: map[string]string{"/upload": "4KB"}}))
+	echo := func(c Context) aicode.HTTPError {
+		var v map[string]string
+		if err := c.Bind(&v); err != nil {
+			return err.(aicode.HTTPError)
+		}
+		c.JSON(http.StatusOK, v)
+		return nil
+	}
+	srv.POST("/", echo)
+	srv.POST("/small", echo, BodyLimit("16B"))
+	srv.POST("/upload", echo)
+
+	body := `{"text":"` + strings.Repeat("a", 2000) + `"}`
+	tests := []struct {
+		target  string
+		body    string
+		chunked bool
+		status  int
+	}{
+		{"/", `{"text":"hi"}`, false, http.StatusOK},
+		{"/", body, false, http.StatusRequestEntityTooLarge},
+		{"/", body, true, http.StatusRequestEntityTooLarge},
+		{"/small", `{"text":"hello world"}`, true, http.StatusRequestEntityTooLarge},
+		{"/upload", body, false, http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(POST, tt.target, strings.NewReader(tt.body))
+		if tt.chunked {
+			req.ContentLength = -1
+			req.Body = ioutil.NopCloser(strings.NewReader(tt.body))
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s (%d bytes, chunked %v): status %d, want %d", tt.target, len(tt.body), tt.chunked, rec.Code, tt.status)
+		}
+	}
+}
+
+func Test_ParseBytes(t *testing.T) {
+	for s, want := range map[string]int64{"100": 100, "512KB": 512 << 10, "2MB": 2 << 20, "1g": 1 << 30, "3 M": 3 << 20} {
+		if got, err := parseBytes(s); err != nil || got != want {
+			t.Errorf("parseBytes(%q) = %d, %v", s, got, err)
+		}
+	}
+	if _, err := parseBytes("two MB"); err == nil {
+		t.Error("invalid limit accepted")
+	}
+}
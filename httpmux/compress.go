@@ -0,0 +1,269 @@
+package httpmux
+
+import (
+	"aicode"
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+type (
+	// CompressConfig defines the config for Compress middleware.
+	CompressConfig struct {
+		// Level is the gzip or deflate compression level.
+		// Default is gzip.DefaultCompression.
+		Level int
+
+		// MinLength is the body size in bytes from which responses are
+		// compressed. Default is 1024.
+		MinLength int
+
+		// ExcludedTypes are Content-Type prefixes which are never compressed,
+		// usually because they are compressed already.
+		// Default is DefaultCompressConfig.ExcludedTypes.
+		ExcludedTypes []string
+	}
+
+	// compressor is implemented by both *gzip.Writer and *zlib.Writer.
+	compressor interface {
+		io.WriteCloser
+		Flush() error
+		Reset(w io.Writer)
+	}
+
+	// compressWriter buffers the body until MinLength bytes are written, then
+	// decides whether to compress it. Headers are held back until then.
+	compressWriter struct {
+		http.ResponseWriter
+		rsp      *Response
+		config   *CompressConfig
+		pool     *sync.Pool
+		encoding string
+		eligible bool
+		code     int
+		buf      []byte
+		decided  bool
+		zw       compressor
+		wire     int64
+		finished bool
+	}
+
+	// wireWriter counts the bytes written to the connection.
+	wireWriter struct {
+		cw *compressWriter
+	}
+)
+
+// DefaultCompressConfig is the default Compress middleware config.
+var DefaultCompressConfig = CompressConfig{
+	Level:     gzip.DefaultCompression,
+	MinLength: 1024,
+	ExcludedTypes: []string{
+		"image/", "video/", "audio/", "font/woff",
+		"application/zip", "application/gzip", "application/x-gzip",
+		"application/grpc", "text/event-stream",
+	},
+}
+
+// Compress returns a middleware which compresses response bodies with gzip or
+// deflate, as negotiated with the Accept-Encoding header.
+func Compress() Middleware {
+	return CompressWithConfig(DefaultCompressConfig)
+}
+
+// CompressWithConfig returns a Compress middleware with config. See Compress.
+//
+// Small bodies, excluded content types, responses which already have a
+// Content-Encoding, answers to Range requests and partial content, whose
+// Content-Range counts the uncompressed bytes, and responses flushed before
+// MinLength bytes were written are sent uncompressed. Response.Size reports the bytes sent on the wire.
+func CompressWithConfig(config CompressConfig) Middleware {
+	if config.Level == 0 {
+		config.Level = DefaultCompressConfig.Level
+	}
+	if config.MinLength == 0 {
+		config.MinLength = DefaultCompressConfig.MinLength
+	}
+	if config.ExcludedTypes == nil {
+		config.ExcludedTypes = DefaultCompressConfig.ExcludedTypes
+	}
+	pools := map[string]*sync.Pool{
+		"gzip": {New: func() interface{} {
+			w, err := gzip.NewWriterLevel(io.Discard, config.Level)
+			if err != nil {
+				w = gzip.NewWriter(io.Discard)
+			}
+			return w
+		}},
+		"deflate": {New: func() interface{} {
+			// The deflate content coding is zlib wrapped, see RFC 9110 8.4.1.2.
+			w, err := zlib.NewWriterLevel(io.Discard, config.Level)
+			if err != nil {
+				w = zlib.NewWriter(io.Discard)
+			}
+			return w
+		}},
+	}
+
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			rsp := c.Response()
+			rsp.Header().Add(HeaderVary, HeaderAcceptEncoding)
+			encoding := ""
+			if accept := c.Request().Header.Get(HeaderAcceptEncoding); acceptsEncoding(accept, "gzip") {
+				encoding = "gzip"
+			} else if acceptsEncoding(accept, "deflate") {
+				encoding = "deflate"
+			}
+			req := c.Request()
+			if encoding == "" || req.Method == HEAD || req.Header.Get(HeaderRange) != "" || c.IsWebSocket() {
+				return next(c)
+			}
+
+			cw := &compressWriter{
+				ResponseWriter: rsp.Writer,
+				rsp:            rsp,
+				config:         &config,
+				pool:           pools[encoding],
+				encoding:       encoding,
+				eligible:       true,
+			}
+			rsp.Writer = cw
+			rsp.Before(cw.checkHeader)
+			rsp.After(func() {
+				// Writes after finish go to the original writer and are
+				// counted by the Response itself.
+				if !cw.finished {
+					rsp.Size = cw.wire
+				}
+			})
+			defer cw.finish()
+			return next(c)
+		}
+	}
+}
+
+// checkHeader runs before the header is written and rules out responses
+// which must not be compressed.
+func (cw *compressWriter) checkHeader() {
+	if cw.finished {
+		return
+	}
+	h := cw.Header()
+	if h.Get(HeaderContentEncoding) != "" || h.Get(HeaderContentRange) != "" {
+		cw.eligible = false
+		return
+	}
+	ctype := strings.ToLower(h.Get(HeaderContentType))
+	for _, t := range cw.config.ExcludedTypes {
+		if strings.HasPrefix(ctype, t) {
+			cw.eligible = false
+			return
+		}
+	}
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	cw.code = code
+	if code < http.StatusOK || code == http.StatusNoContent || code == http.StatusPartialContent ||
+		code == http.StatusNotModified {
+		cw.eligible = false
+	}
+	if !cw.eligible {
+		cw.decide(false)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if cw.code == 0 {
+		cw.WriteHeader(http.StatusOK)
+	}
+	if !cw.decided {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) >= cw.config.MinLength {
+			if err := cw.decide(true); err != nil {
+				return 0, err
+			}
+		}
+		return len(b), nil
+	}
+	if cw.zw != nil {
+		return cw.zw.Write(b)
+	}
+	return wireWriter{cw}.Write(b)
+}
+
+// decide sends the header, compressed or not, followed by the buffered body.
+func (cw *compressWriter) decide(compress bool) error {
+	if cw.decided {
+		return nil
+	}
+	cw.decided = true
+	if compress {
+		h := cw.Header()
+		h.Del(HeaderContentLength)
+		h.Set(HeaderContentEncoding, cw.encoding)
+		cw.zw = cw.pool.Get().(compressor)
+		cw.zw.Reset(wireWriter{cw})
+	}
+	cw.ResponseWriter.WriteHeader(cw.code)
+	if len(cw.buf) == 0 {
+		return nil
+	}
+	buf := cw.buf
+	cw.buf = nil
+	var err error
+	if cw.zw != nil {
+		_, err = cw.zw.Write(buf)
+	} else {
+		_, err = wireWriter{cw}.Write(buf)
+	}
+	return err
+}
+
+// Flush sends the response uncompressed when called before a decision was
+// made, since streaming responses must reach the client as written.
+func (cw *compressWriter) Flush() {
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	cw.decide(false)
+	if cw.zw != nil {
+		cw.zw.Flush()
+	}
+	if f, ok := cw.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+	cw.rsp.Size = cw.wire
+}
+
+func (cw *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return cw.ResponseWriter.(http.Hijacker).Hijack()
+}
+
+// finish runs when the handle returns. It sends a body shorter than MinLength
+// as is, closes the compressor and restores the original writer.
+func (cw *compressWriter) finish() {
+	if cw.code != 0 {
+		cw.decide(false)
+	}
+	if cw.zw != nil {
+		cw.zw.Close()
+		cw.pool.Put(cw.zw)
+		cw.zw = nil
+	}
+	cw.rsp.Writer = cw.ResponseWriter
+	cw.rsp.Size = cw.wire
+	cw.finished = true
+}
+
+func (w wireWriter) Write(b []byte) (int, error) {
+	n, err := w.cw.ResponseWriter.Write(b)
+	w.cw.wire += int64(n)
+	return n, err
+}
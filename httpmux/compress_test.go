@@ -0,0 +1,137 @@
+package httpmux
+
+import (
+	"aicode"
+	"compress/gzip"
+	"compress/zlib"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_Compress(t *testing.T) {
+	large := strings.Repeat("recognition result ", 200)
+	var size int64
+	srv := New()
+	srv.Use(func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			err := next(c)
+			size = c.Response().Size
+			return err
+		}
+	}, Compress())
+	srv.GET("/large", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, large)
+		return nil
+	})
+	srv.GET("/small", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, "ok")
+		return nil
+	})
+	srv.GET("/image", func(c Context) aicode.HTTPError {
+		c.Blob(http.StatusOK, "image/png", []byte(large))
+		return nil
+	})
+
+	req := httptest.NewRequest(GET, "/large", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip, deflate")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Header().Get(HeaderContentEncoding) != "gzip" || rec.Header().Get(HeaderVary) != HeaderAcceptEncoding {
+		t.Fatalf("large headers %v", rec.Header())
+	}
+	if size != int64(rec.Body.Len()) || size >= int64(len(large)) {
+		t.Errorf("Response.Size %d, wire %d, plain %d", size, rec.Body.Len(), len(large))
+	}
+	zr, err := gzip.NewReader(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := ioutil.ReadAll(zr); string(b) != large {
+		t.Errorf("decompressed body differs")
+	}
+
+	req = httptest.NewRequest(GET, "/large", nil)
+	req.Header.Set(HeaderAcceptEncoding, "deflate")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Header().Get(HeaderContentEncoding) != "deflate" {
+		t.Fatalf("deflate headers %v", rec.Header())
+	}
+	dr, err := zlib.NewReader(rec.Body)
+	if err != nil {
+		t.Fatalf("deflate body is not zlib wrapped: %v", err)
+	}
+	if b, _ := ioutil.ReadAll(dr); string(b) != large {
+		t.Errorf("inflated body differs")
+	}
+
+	for _, target := range []string{"/small", "/image"} {
+		req := httptest.NewRequest(GET, target, nil)
+		req.Header.Set(HeaderAcceptEncoding, "gzip")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Header().Get(HeaderContentEncoding) != "" || size != int64(rec.Body.Len()) {
+			t.Errorf("%s: encoding %q, size %d", target, rec.Header().Get(HeaderContentEncoding), size)
+		}
+	}
+}
+
+func Test_CompressSizeAfterFinish(t *testing.T) {
+	large := strings.Repeat("recognition result ", 200)
+	var size int64
+	srv := New()
+	srv.Use(func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			err := next(c)
+			// Written after Compress returned, like the error handler does.
+			c.Response().Write([]byte("tail"))
+			size = c.Response().Size
+			return err
+		}
+	}, Compress())
+	srv.GET("/large", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, large)
+		return nil
+	})
+
+	req := httptest.NewRequest(GET, "/large", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if size != int64(rec.Body.Len()) {
+		t.Errorf("Response.Size %d, wire %d", size, rec.Body.Len())
+	}
+}
+
+func Test_CompressRange(t *testing.T) {
+	body := strings.Repeat("0123456789", 500)
+	srv := New()
+	srv.Use(Compress())
+	srv.StaticFS("/assets", fstest.MapFS{"data.txt": {Data: []byte(body)}})
+	srv.GET("/partial", func(c Context) aicode.HTTPError {
+		c.Response().Header().Set(HeaderContentRange, "bytes 0-1999/5000")
+		c.String(http.StatusPartialContent, body[:2000])
+		return nil
+	})
+
+	req := httptest.NewRequest(GET, "/assets/data.txt", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+	req.Header.Set(HeaderRange, "bytes=0-1999")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusPartialContent || rec.Header().Get(HeaderContentEncoding) != "" || rec.Body.String() != body[:2000] {
+		t.Errorf("range: status %d, encoding %q, %d bytes", rec.Code, rec.Header().Get(HeaderContentEncoding), rec.Body.Len())
+	}
+
+	req = httptest.NewRequest(GET, "/partial", nil)
+	req.Header.Set(HeaderAcceptEncoding, "gzip")
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Header().Get(HeaderContentEncoding) != "" || rec.Body.String() != body[:2000] {
+		t.Errorf("partial content: encoding %q, %d bytes", rec.Header().Get(HeaderContentEncoding), rec.Body.Len())
+	}
+}
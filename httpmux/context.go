@@ -1,13 +1,14 @@
 package httpmux
 
 import (
+	"bytes"
+	stdContext "context"
 	"encoding/json"
 	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"mime/multipart"
-	"net"
 	"net/http"
 	"net/url"
 	"os"
@@ -15,6 +16,7 @@ import (
 	"strings"
 
 	valid "github.com/asaskevich/govalidator"
+	"github.com/julienschmidt/httprouter"
 )
 
 type (
@@ -27,6 +29,10 @@ type (
 		// SetRequest sets `*http.Request`.
 		SetRequest(r *http.Request)
 
+		// Context returns the request's context.Context. It is cancelled when the
+		// client goes away, and carries the deadline set by Timeout middleware.
+		Context() stdContext.Context
+
 		// Response returns `*Response`.
 		Response() *Response
 
@@ -36,11 +42,17 @@ type (
 		// IsWebSocket returns true if HTTP connection is WebSocket otherwise false.
 		IsWebSocket() bool
 
-		// Scheme returns the HTTP protocol scheme, `http` or `https`.
+		// WebSocket upgrades the connection to the WebSocket protocol with the
+		// server WebSocket config. When the upgrade fails the error response has
+		// been sent already.
+		WebSocket() (*WebSocketConn, error)
+
+		// Scheme returns the HTTP protocol scheme, `http` or `https`. The
+		// forwarded protocol is only honoured from the server TrustedProxies.
 		Scheme() string
 
-		// RealIP returns the client's network address based on `X-Forwarded-For`
-		// or `X-Real-IP` request header.
+		// RealIP returns the client's network address. Forwarded, X-Forwarded-For
+		// and X-Real-IP headers are only honoured from the server TrustedProxies.
 		RealIP() string
 
 		// Path returns the registered path for the handler.
@@ -64,6 +76,15 @@ type (
 		// SetParamValues sets path parameter values.
 		SetParamValues(values ...string)
 
+		// SSE starts a Server-Sent Events stream: it sends the event-stream headers
+		// and keeps the connection alive with heartbeats until the stream is
+		// closed or the request is done.
+		SSE() (*EventStream, error)
+
+		// Session returns the session of the request, loading it on first use.
+		// It returns ErrNoSession when the Sessions middleware did not run.
+		Session() (*Session, error)
+
 		// QueryParam returns the query param for the provided name.
 		QueryParam(name string) string
 
@@ -91,14 +112,19 @@ type (
 		// Set saves data in the context.
 		Set(key string, val interface{})
 
-		// Bind binds the request body into provided type `i`. The default binder
-		// does it based on Content-Type header.
+		// Bind binds path params, query params, headers and the request body into
+		// provided type `i` using the server Binder. The default binder decodes the
+		// body based on Content-Type header.
 		Bind(i interface{}) error
 
 		// Validate validates provided `i`. It is usually called after `Context#Bind()`.
 		// Validator must be registered using `Echo#Validator`.
 		Validate(i interface{}) error
 
+		// Render renders a template with data and sends a text/html response with
+		// status code. Renderer must be registered on the server.
+		Render(code int, name string, data interface{}) error
+
 		// HTML sends an HTTP response with status code.
 		HTML(code int, html string) error
 
@@ -140,7 +166,9 @@ type (
 		// Stream sends a streaming response with status code and content type.
 		Stream(code int, contentType string, r io.Reader) error
 
-		// File sends a response with the content of the file.
+		// File sends a response with the content of the file, or of its index.html
+		// when file is a directory. A missing file is reported as
+		// aicode.ComNotExist.
 		File(file string) error
 
 		// Attachment sends a response as attachment, prompting client to save the
@@ -157,6 +185,7 @@ type (
 		Redirect(code int, url string) error
 
 		// Error invokes the registered HTTP error handler. Generally used by middleware.
+		// The aicode code of the error is kept, see ErrorCode.
 		Error(err error)
 
 		// Reset resets the context after request completes. It must be called along
@@ -197,6 +226,10 @@ func (c *context) SetRequest(r *http.Request) {
 	c.request = r
 }
 
+func (c *context) Context() stdContext.Context {
+	return c.request.Context()
+}
+
 func (c *context) Response() *Response {
 	return c.response
 }
@@ -216,31 +249,15 @@ func (c *context) Scheme() string {
 	if c.IsTLS() {
 		return "https"
 	}
-	if scheme := c.request.Header.Get(HeaderXForwardedProto); scheme != "" {
-		return scheme
-	}
-	if scheme := c.request.Header.Get(HeaderXForwardedProtocol); scheme != "" {
-		return scheme
-	}
-	if ssl := c.request.Header.Get(HeaderXForwardedSsl); ssl == "on" {
-		return "https"
-	}
-	if scheme := c.request.Header.Get(HeaderXUrlScheme); scheme != "" {
-		return scheme
+	if _, proto := c.forwarded(); proto != "" {
+		return proto
 	}
 	return "http"
 }
 
 func (c *context) RealIP() string {
-	ra := c.request.RemoteAddr
-	if ip := c.request.Header.Get(HeaderXForwardedFor); ip != "" {
-		ra = strings.Split(ip, ", ")[0]
-	} else if ip := c.request.Header.Get(HeaderXRealIP); ip != "" {
-		ra = ip
-	} else {
-		ra, _, _ = net.SplitHostPort(ra)
-	}
-	return ra
+	ip, _ := c.forwarded()
+	return ip
 }
 
 func (c *context) Path() string {
@@ -278,6 +295,17 @@ func (c *context) SetParamValues(values ...string) {
 	c.pvalues = values
 }
 
+// setParams copies the parameters matched by the router. Catch-all parameters
+// such as `*path` keep the leading slash given by httprouter.
+func (c *context) setParams(ps httprouter.Params) {
+	c.pnames = make([]string, len(ps))
+	c.pvalues = make([]string, len(ps))
+	for i, p := range ps {
+		c.pnames[i] = p.Key
+		c.pvalues[i] = p.Value
+	}
+}
+
 func (c *context) QueryParam(name string) string {
 	if c.query == nil {
 		c.query = c.request.URL.Query()
@@ -302,7 +330,7 @@ func (c *context) FormValue(name string) string {
 
 func (c *context) FormParams() (url.Values, error) {
 	if strings.HasPrefix(c.request.Header.Get(HeaderContentType), MIMEMultipartForm) {
-		if err := c.request.ParseMultipartForm(defaultMemory); err != nil {
+		if err := c.request.ParseMultipartForm(c.multipartMemory()); err != nil {
 			return nil, err
 		}
 	} else {
@@ -319,10 +347,19 @@ func (c *context) FormFile(name string) (*multipart.FileHeader, error) {
 }
 
 func (c *context) MultipartForm() (*multipart.Form, error) {
-	err := c.request.ParseMultipartForm(defaultMemory)
+	err := c.request.ParseMultipartForm(c.multipartMemory())
 	return c.request.MultipartForm, err
 }
 
+// multipartMemory returns the memory used to parse a multipart form.
+func (c *context) multipartMemory() int64 {
+	max := c.mux.MaxMultipartMemory
+	if limit := bodyLimit(c.request.Body); limit >= 0 && limit < max {
+		max = limit
+	}
+	return max
+}
+
 func (c *context) Get(key string) interface{} {
 	return c.store[key]
 }
@@ -335,7 +372,7 @@ func (c *context) Set(key string, val interface{}) {
 }
 
 func (c *context) Bind(i interface{}) error {
-	return json.NewDecoder(c.request.Body).Decode(i)
+	return c.mux.Binder.Bind(i, c)
 }
 
 func (c *context) Validate(i interface{}) error {
@@ -343,6 +380,17 @@ func (c *context) Validate(i interface{}) error {
 	return err
 }
 
+func (c *context) Render(code int, name string, data interface{}) (err error) {
+	if c.mux.Renderer == nil {
+		return errors.New("renderer not registered")
+	}
+	buf := new(bytes.Buffer)
+	if err = c.mux.Renderer.Render(buf, name, data, c); err != nil {
+		return
+	}
+	return c.HTMLBlob(code, buf.Bytes())
+}
+
 func (c *context) HTML(code int, html string) (err error) {
 	return c.HTMLBlob(code, []byte(html))
 }
@@ -437,26 +485,11 @@ func (c *context) Stream(code int, contentType string, r io.Reader) (err error)
 }
 
 func (c *context) File(file string) (err error) {
-	f, err := os.Open(file)
-	if err != nil {
-		// return NotFoundHandler(c)
+	dir, name := filepath.Split(file)
+	if dir == "" {
+		dir = "."
 	}
-	defer f.Close()
-
-	fi, _ := f.Stat()
-	if fi.IsDir() {
-		file = filepath.Join(file, indexPage)
-		f, err = os.Open(file)
-		if err != nil {
-			// return NotFoundHandler(c)
-		}
-		defer f.Close()
-		if fi, err = f.Stat(); err != nil {
-			return
-		}
-	}
-	http.ServeContent(c.Response(), c.Request(), fi.Name(), fi.ModTime(), f)
-	return
+	return serveFS(c, os.DirFS(dir), name, indexPage, false)
 }
 
 func (c *context) Attachment(file, name string) error {
@@ -487,13 +520,34 @@ func (c *context) Redirect(code int, url string) error {
 }
 
 func (c *context) Error(err error) {
-	// c.pd.HTTPErrorHandler(err, c)
+	if !c.response.Committed {
+		c.Set(errorCodeKey, errorCodeOf(err))
+	}
+	c.mux.HTTPErrorHandler(err, c)
 }
 
 // func (c *context) Logger() Logger {
 // 	return c.pd.Logger
 // }
 
+// clone returns a copy of c serving req and writing to w, which shares no
+// mutable state with c and can be handed to another goroutine.
+func (c *context) clone(req *http.Request, w http.ResponseWriter) *context {
+	store := make(map[string]interface{}, len(c.store))
+	for k, v := range c.store {
+		store[k] = v
+	}
+	return &context{
+		request:  req,
+		response: NewResponse(w, c.mux),
+		path:     c.path,
+		pnames:   c.pnames,
+		pvalues:  c.pvalues,
+		store:    store,
+		mux:      c.mux,
+	}
+}
+
 func (c *context) Reset(r *http.Request, w http.ResponseWriter) {
 	c.request = r
 	c.response.reset(w)
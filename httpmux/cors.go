@@ -0,0 +1,156 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// CORSConfig defines the config for CORS middleware.
+type CORSConfig struct {
+	// AllowOrigins lists the origins which may access the resource. An entry
+	// may hold one `*` wildcard, e.g. "https://*.example.com" allows every
+	// subdomain of example.com. Default is []string{"*"}.
+	AllowOrigins []string
+
+	// AllowOriginFunc decides whether an origin may access the resource. It is
+	// consulted when no entry of AllowOrigins matches.
+	AllowOriginFunc func(origin string) bool
+
+	// AllowMethods lists the methods allowed for preflight requests.
+	// Default is DefaultCORSConfig.AllowMethods.
+	AllowMethods []string
+
+	// AllowHeaders lists the request headers allowed for preflight requests.
+	// Default echoes the Access-Control-Request-Headers request header.
+	AllowHeaders []string
+
+	// AllowCredentials allows cookies and authorization headers to be sent.
+	// A `*` origin is answered with the request Origin in that case.
+	AllowCredentials bool
+
+	// ExposeHeaders lists the response headers readable by the client.
+	ExposeHeaders []string
+
+	// MaxAge is how long in seconds the preflight result may be cached.
+	MaxAge int
+}
+
+// DefaultCORSConfig is the default CORS middleware config.
+var DefaultCORSConfig = CORSConfig{
+	AllowOrigins: []string{"*"},
+	AllowMethods: []string{GET, HEAD, PUT, PATCH, POST, DELETE},
+}
+
+// CORS returns a Cross-Origin Resource Sharing middleware allowing any origin.
+func CORS() Middleware {
+	return CORSWithConfig(DefaultCORSConfig)
+}
+
+// CORSWithConfig returns a CORS middleware with config.
+//
+// Preflight requests are answered by the middleware without calling the next
+// handle. The server answers OPTIONS requests for every registered route by
+// running the global middleware only, so the middleware must be added with
+// server.Use to handle preflights.
+func CORSWithConfig(config CORSConfig) Middleware {
+	if len(config.AllowOrigins) == 0 && config.AllowOriginFunc == nil {
+		config.AllowOrigins = DefaultCORSConfig.AllowOrigins
+	}
+	if len(config.AllowMethods) == 0 {
+		config.AllowMethods = DefaultCORSConfig.AllowMethods
+	}
+	allowMethods := strings.Join(config.AllowMethods, ",")
+	allowHeaders := strings.Join(config.AllowHeaders, ",")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ",")
+	maxAge := strconv.Itoa(config.MaxAge)
+
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			req, h := c.Request(), c.Response().Header()
+			origin := req.Header.Get(HeaderOrigin)
+			preflight := req.Method == OPTIONS && req.Header.Get(HeaderAccessControlRequestMethod) != ""
+			h.Add(HeaderVary, HeaderOrigin)
+
+			allowOrigin := ""
+			if origin != "" {
+				allowOrigin = config.allowOrigin(origin)
+			}
+			if !preflight {
+				if allowOrigin != "" {
+					h.Set(HeaderAccessControlAllowOrigin, allowOrigin)
+					if config.AllowCredentials {
+						h.Set(HeaderAccessControlAllowCredentials, "true")
+					}
+					if exposeHeaders != "" {
+						h.Set(HeaderAccessControlExposeHeaders, exposeHeaders)
+					}
+				}
+				return next(c)
+			}
+
+			h.Add(HeaderVary, HeaderAccessControlRequestMethod)
+			h.Add(HeaderVary, HeaderAccessControlRequestHeaders)
+			if allowOrigin == "" {
+				c.NoContent(http.StatusNoContent)
+				return nil
+			}
+			h.Set(HeaderAccessControlAllowOrigin, allowOrigin)
+			h.Set(HeaderAccessControlAllowMethods, allowMethods)
+			if config.AllowCredentials {
+				h.Set(HeaderAccessControlAllowCredentials, "true")
+			}
+			if allowHeaders != "" {
+				h.Set(HeaderAccessControlAllowHeaders, allowHeaders)
+			} else if requested := req.Header.Get(HeaderAccessControlRequestHeaders); requested != "" {
+				h.Set(HeaderAccessControlAllowHeaders, requested)
+			}
+			if config.MaxAge > 0 {
+				h.Set(HeaderAccessControlMaxAge, maxAge)
+			}
+			c.NoContent(http.StatusNoContent)
+			return nil
+		}
+	}
+}
+
+// allowOrigin returns the Access-Control-Allow-Origin value for origin, or ""
+// if the origin is not allowed.
+func (config *CORSConfig) allowOrigin(origin string) string {
+	lower := strings.ToLower(origin)
+	for _, o := range config.AllowOrigins {
+		if o == "*" {
+			if config.AllowCredentials {
+				return origin
+			}
+			return "*"
+		}
+		if matchOrigin(strings.ToLower(o), lower) {
+			return origin
+		}
+	}
+	if config.AllowOriginFunc != nil && config.AllowOriginFunc(origin) {
+		return origin
+	}
+	return ""
+}
+
+// matchOrigin matches origin against pattern, where a `*` in pattern stands
+// for one or more host name labels.
+func matchOrigin(pattern, origin string) bool {
+	i := strings.IndexByte(pattern, '*')
+	if i < 0 {
+		return pattern == origin
+	}
+	prefix, suffix := pattern[:i], pattern[i+1:]
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+	for _, r := range origin[len(prefix) : len(origin)-len(suffix)] {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,53 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_CORS(t *testing.T) {
+	srv := New()
+	srv.Use(CORSWithConfig(CORSConfig{
+		AllowOrigins:     []string{"https://*.example.com"},
+		AllowOriginFunc:  func(origin string) bool { return origin == "http://localhost:8080" },
+		AllowCredentials: true,
+		MaxAge:           600,
+	}))
+	srv.POST("/api/stream", func(c Context) aicode.HTTPError {
+		c.NoContent(http.StatusOK)
+		return nil
+	})
+
+	tests := []struct {
+		method string
+		origin string
+		status int
+		allow  string
+	}{
+		{OPTIONS, "https://admin.example.com", http.StatusNoContent, "https://admin.example.com"},
+		{OPTIONS, "https://evil.com", http.StatusNoContent, ""},
+		{OPTIONS, "https://example.com", http.StatusNoContent, ""},
+		{POST, "http://localhost:8080", http.StatusOK, "http://localhost:8080"},
+		{POST, "https://a.b.example.com", http.StatusOK, "https://a.b.example.com"},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(tt.method, "/api/stream", nil)
+		req.Header.Set(HeaderOrigin, tt.origin)
+		if tt.method == OPTIONS {
+			req.Header.Set(HeaderAccessControlRequestMethod, POST)
+			req.Header.Set(HeaderAccessControlRequestHeaders, HeaderContentType)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != tt.status || rec.Header().Get(HeaderAccessControlAllowOrigin) != tt.allow {
+			t.Errorf("%s %s: status %d, allow origin %q", tt.method, tt.origin, rec.Code, rec.Header().Get(HeaderAccessControlAllowOrigin))
+		}
+		if tt.method == OPTIONS && tt.allow != "" {
+			if rec.Header().Get(HeaderAccessControlMaxAge) != "600" || rec.Header().Get(HeaderAccessControlAllowHeaders) != HeaderContentType {
+				t.Errorf("preflight headers %v", rec.Header())
+			}
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package httpmux
+
+import (
+	"aicode"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// CSRFConfig defines the config for CSRF middleware.
+type CSRFConfig struct {
+	// Secret signs the token cookie, so that only cookies issued by the
+	// server are accepted. Default is a random secret, which invalidates the
+	// tokens when the process restarts; services with several instances must
+	// share one.
+	Secret []byte
+
+	// SessionID returns the session or user the request belongs to, which is
+	// signed with the token cookie. It must not change between the requests
+	// of a client, e.g. the ID of a saved session. Without it a cookie
+	// obtained by an attacker and planted by a sibling domain is accepted;
+	// with it that cookie is rejected, since it was issued to another
+	// session. Default is none.
+	SessionID func(c Context) string
+
+	// Header is the request header carrying the token.
+	// Default is HeaderXCSRFToken.
+	Header string
+
+	// FormField is the form field carrying the token. Default is "_csrf".
+	FormField string
+
+	// CookieName is the name of the token cookie. Default is "_csrf".
+	CookieName string
+
+	// CookiePath and CookieDomain scope the token cookie.
+	// Default path is "/".
+	CookiePath   string
+	CookieDomain string
+
+	// CookieMaxAge is the lifetime of the token cookie. Default is 24 hours.
+	CookieMaxAge time.Duration
+
+	// CookieSameSite is the SameSite attribute of the token cookie.
+	// Default is http.SameSiteLaxMode.
+	CookieSameSite http.SameSite
+}
+
+const (
+	csrfTokenKey = "httpmux.csrf_token"
+	csrfRawLen   = 32
+)
+
+// DefaultCSRFConfig is the default CSRF middleware config.
+var DefaultCSRFConfig = CSRFConfig{
+	Header:         HeaderXCSRFToken,
+	FormField:      "_csrf",
+	CookieName:     "_csrf",
+	CookiePath:     "/",
+	CookieMaxAge:   24 * time.Hour,
+	CookieSameSite: http.SameSiteLaxMode,
+}
+
+// CSRF returns a middleware protecting against cross-site request forgery
+// with DefaultCSRFConfig.
+func CSRF() Middleware {
+	return CSRFWithConfig(DefaultCSRFConfig)
+}
+
+// CSRFWithConfig returns a CSRF middleware with config. See CSRF.
+//
+// A random secret is kept in a signed, HttpOnly cookie. Every request gets a
+// token derived from it, available from CSRFToken and the csrfToken template
+// function, which must be sent back in the header or the form field with
+// POST, PUT, PATCH and DELETE requests. Tokens are masked with fresh random
+// bytes on every request, so they do not leak through compressed responses.
+// Requests without a valid token are rejected with aicode.ComAuthFailed.
+func CSRFWithConfig(config CSRFConfig) Middleware {
+	if len(config.Secret) == 0 {
+		config.Secret = make([]byte, 32)
+		rand.Read(config.Secret)
+	}
+	if config.Header == "" {
+		config.Header = DefaultCSRFConfig.Header
+	}
+	if config.FormField == "" {
+		config.FormField = DefaultCSRFConfig.FormField
+	}
+	if config.CookieName == "" {
+		config.CookieName = DefaultCSRFConfig.CookieName
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = DefaultCSRFConfig.CookiePath
+	}
+	if config.CookieMaxAge == 0 {
+		config.CookieMaxAge = DefaultCSRFConfig.CookieMaxAge
+	}
+	if config.CookieSameSite == 0 {
+		config.CookieSameSite = DefaultCSRFConfig.CookieSameSite
+	}
+
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			req := c.Request()
+			c.Response().Header().Add(HeaderVary, "Cookie")
+
+			sid := ""
+			if config.SessionID != nil {
+				sid = config.SessionID(c)
+			}
+			var raw []byte
+			if ck, err := req.Cookie(config.CookieName); err == nil {
+				raw = config.verify(ck.Value, sid)
+			}
+			if raw == nil {
+				if !safeMethod(req.Method) {
+					return aicode.ComAuthFailed
+				}
+				raw = make([]byte, csrfRawLen)
+				rand.Read(raw)
+				http.SetCookie(c.Response(), &http.Cookie{
+					Name:     config.CookieName,
+					Value:    config.sign(raw, sid),
+					Path:     config.CookiePath,
+					Domain:   config.CookieDomain,
+					MaxAge:   int(config.CookieMaxAge / time.Second),
+					Secure:   c.Scheme() == "https",
+					HttpOnly: true,
+					SameSite: config.CookieSameSite,
+				})
+			}
+
+			if !safeMethod(req.Method) {
+				token := req.Header.Get(config.Header)
+				if token == "" {
+					token = c.FormValue(config.FormField)
+				}
+				if !csrfTokenMatches(token, raw) {
+					return aicode.ComAuthFailed
+				}
+			}
+			c.Set(csrfTokenKey, maskCSRF(raw))
+			return next(c)
+		}
+	}
+}
+
+// CSRFToken returns the CSRF token of the request, or "" when the CSRF
+// middleware did not run. Templates rendered by a TemplateRenderer get it
+// from the csrfToken function.
+func CSRFToken(c Context) string {
+	token, _ := c.Get(csrfTokenKey).(string)
+	return token
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case GET, HEAD, OPTIONS, http.MethodTrace:
+		return true
+	}
+	return false
+}
+
+// mac signs raw for the session sid. raw has a fixed length, so the two can't
+// be shifted into each other.
+func (config *CSRFConfig) mac(raw []byte, sid string) []byte {
+	m := hmac.New(sha256.New, config.Secret)
+	m.Write(raw)
+	m.Write([]byte(sid))
+	return m.Sum(nil)
+}
+
+// sign encodes raw with its signature as the cookie value.
+func (config *CSRFConfig) sign(raw []byte, sid string) string {
+	return base64.RawURLEncoding.EncodeToString(raw) + "." + base64.RawURLEncoding.EncodeToString(config.mac(raw, sid))
+}
+
+// verify returns the raw secret of a cookie value, or nil if it is not signed
+// by config.Secret for the session sid.
+func (config *CSRFConfig) verify(value, sid string) []byte {
+	i := strings.IndexByte(value, '.')
+	if i < 0 {
+		return nil
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value[:i])
+	if err != nil || len(raw) != csrfRawLen {
+		return nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil || !hmac.Equal(sig, config.mac(raw, sid)) {
+		return nil
+	}
+	return raw
+}
+
+// maskCSRF returns a token made of a random mask and raw XORed with it.
+func maskCSRF(raw []byte) string {
+	token := make([]byte, 2*len(raw))
+	mask := token[:len(raw)]
+	rand.Read(mask)
+	for i, b := range raw {
+		token[len(raw)+i] = b ^ mask[i]
+	}
+	return base64.RawURLEncoding.EncodeToString(token)
+}
+
+func csrfTokenMatches(token string, raw []byte) bool {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 2*len(raw) {
+		return false
+	}
+	mask, masked := b[:len(raw)], b[len(raw):]
+	unmasked := make([]byte, len(raw))
+	for i := range raw {
+		unmasked[i] = masked[i] ^ mask[i]
+	}
+	return subtle.ConstantTimeCompare(unmasked, raw) == 1
+}
@@ -0,0 +1,115 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_CSRF(t *testing.T) {
+	fsys := fstest.MapFS{
+		"consent.html": {Data: []byte(`<input name="_csrf" value="{{csrfToken}}">`)},
+	}
+	r, err := NewTemplateRenderer(fsys, nil, "consent.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New()
+	srv.Renderer = r
+	g := srv.Group("/oauth", CSRFWithConfig(CSRFConfig{Secret: []byte("secret")}))
+	g.GET("/consent", func(c Context) aicode.HTTPError {
+		c.Render(http.StatusOK, "consent.html", nil)
+		return nil
+	})
+	g.POST("/consent", func(c Context) aicode.HTTPError {
+		c.NoContent(http.StatusNoContent)
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/oauth/consent", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly || cookies[0].SameSite != http.SameSiteLaxMode {
+		t.Fatalf("cookies %v", cookies)
+	}
+	cookie := cookies[0]
+	body := rec.Body.String()
+	token := strings.TrimSuffix(strings.TrimPrefix(body, `<input name="_csrf" value="`), `">`)
+
+	post := func(cookie *http.Cookie, header string, form url.Values) int {
+		req := httptest.NewRequest(POST, "/oauth/consent", strings.NewReader(form.Encode()))
+		req.Header.Set(HeaderContentType, MIMEApplicationForm)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		if header != "" {
+			req.Header.Set(HeaderXCSRFToken, header)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	if code := post(cookie, "", url.Values{"_csrf": {token}}); code != http.StatusNoContent {
+		t.Errorf("form token: status %d", code)
+	}
+	if code := post(cookie, token, nil); code != http.StatusNoContent {
+		t.Errorf("header token: status %d", code)
+	}
+	if code := post(cookie, "", nil); code != http.StatusForbidden {
+		t.Errorf("missing token: status %d", code)
+	}
+	if code := post(nil, token, nil); code != http.StatusForbidden {
+		t.Errorf("missing cookie: status %d", code)
+	}
+	forged := &http.Cookie{Name: cookie.Name, Value: cookie.Value[:strings.IndexByte(cookie.Value, '.')] + ".AAAA"}
+	if code := post(forged, token, nil); code != http.StatusForbidden {
+		t.Errorf("forged cookie: status %d", code)
+	}
+
+	req := httptest.NewRequest(GET, "/oauth/consent", nil)
+	req.AddCookie(cookie)
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if len(rec.Result().Cookies()) != 0 || rec.Body.String() == body {
+		t.Errorf("cookie reissued or token not re-masked: %q", rec.Body.String())
+	}
+}
+
+func Test_CSRFSessionBinding(t *testing.T) {
+	srv := New()
+	srv.Use(CSRFWithConfig(CSRFConfig{
+		Secret:    []byte("secret"),
+		SessionID: func(c Context) string { return c.Request().Header.Get("X-Session") },
+	}))
+	srv.GET("/form", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, CSRFToken(c))
+		return nil
+	})
+	srv.POST("/form", func(c Context) aicode.HTTPError {
+		c.NoContent(http.StatusNoContent)
+		return nil
+	})
+
+	// The attacker gets a cookie and a token for their own session.
+	req := httptest.NewRequest(GET, "/form", nil)
+	req.Header.Set("X-Session", "attacker")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	cookie, token := rec.Result().Cookies()[0], rec.Body.String()
+
+	for sid, want := range map[string]int{"attacker": http.StatusNoContent, "victim": http.StatusForbidden} {
+		req := httptest.NewRequest(POST, "/form", nil)
+		req.Header.Set("X-Session", sid)
+		req.Header.Set(HeaderXCSRFToken, token)
+		req.AddCookie(cookie)
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != want {
+			t.Errorf("%s: status %d, want %d", sid, rec.Code, want)
+		}
+	}
+}
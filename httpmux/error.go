@@ -0,0 +1,112 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"sync"
+)
+
+// StatusClientClosedRequest is the non-standard status, borrowed from nginx,
+// of requests whose client went away before the response was sent.
+const StatusClientClosedRequest = 499
+
+// HTTPErrorHandler is a centralized HTTP error handler. It is invoked by
+// Context.Error for every error returned by a Handle.
+type HTTPErrorHandler func(err error, c Context)
+
+var (
+	statusMu   sync.RWMutex
+	codeStatus = map[int]int{
+		aicode.ComInnerError.Code():     http.StatusInternalServerError,
+		aicode.ComNotExist.Code():       http.StatusNotFound,
+		aicode.ComUnAuthorized.Code():   http.StatusUnauthorized,
+		aicode.ComAuthFailed.Code():     http.StatusForbidden,
+		aicode.ComBadParam.Code():       http.StatusBadRequest,
+		aicode.ComSupportScheme.Code():  http.StatusBadRequest,
+		aicode.ComLimit.Code():          http.StatusTooManyRequests,
+		aicode.ComDuplicate.Code():      http.StatusConflict,
+		aicode.ComEntityTooLarge.Code(): http.StatusRequestEntityTooLarge,
+		aicode.ComMissSid.Code():        http.StatusBadRequest,
+		aicode.ComAuthExpired.Code():    http.StatusUnauthorized,
+		aicode.ComDataInvalid.Code():    http.StatusUnprocessableEntity,
+		aicode.ComTimeout.Code():        http.StatusServiceUnavailable,
+		aicode.ComCanceled.Code():       StatusClientClosedRequest,
+	}
+)
+
+// RegisterStatus maps an aicode error code to the HTTP status written by the
+// default error handler. It is usually called from init for service specific
+// codes.
+func RegisterStatus(code, status int) {
+	statusMu.Lock()
+	codeStatus[code] = status
+	statusMu.Unlock()
+}
+
+// StatusCode returns the HTTP status for an aicode error code. Codes which
+// were never registered map to 500.
+func StatusCode(code int) int {
+	statusMu.RLock()
+	status, ok := codeStatus[code]
+	statusMu.RUnlock()
+	if !ok {
+		return http.StatusInternalServerError
+	}
+	return status
+}
+
+// errorCodeKey is the Context store key of the code of the error committed by
+// Context.Error.
+const errorCodeKey = "httpmux.error_code"
+
+// ErrorCode returns the aicode code of the error passed to Context.Error
+// before the response was committed, or 0 if there was none. Errors which
+// are not aicode errors have the code of aicode.ComInnerError.
+func ErrorCode(c Context) int {
+	code, _ := c.Get(errorCodeKey).(int)
+	return code
+}
+
+func errorCodeOf(err error) int {
+	if he, ok := err.(aicode.HTTPError); ok {
+		return he.Code()
+	}
+	return aicode.ComInnerError.Code()
+}
+
+// outcome returns the status and the aicode error code a request ends with,
+// err being returned by the next handle of a middleware. An error which is
+// not handled yet is expected to be sent with the status mapped by
+// StatusCode once Context.Error is called further out.
+func outcome(c Context, err aicode.HTTPError) (int, int) {
+	rsp := c.Response()
+	switch {
+	case err != nil && !rsp.Committed:
+		return StatusCode(err.Code()), err.Code()
+	case err != nil:
+		return rsp.Status, err.Code()
+	case rsp.Committed:
+		return rsp.Status, ErrorCode(c)
+	}
+	// Nothing written: net/http sends 200 with an empty body.
+	return http.StatusOK, 0
+}
+
+// DefaultHTTPErrorHandler writes the error as a `{code,msg}` JSON body with the
+// HTTP status mapped from its aicode code. Errors which are not aicode errors
+// are reported as aicode.ComInnerError without exposing their message.
+func DefaultHTTPErrorHandler(err error, c Context) {
+	if c.Response().Committed {
+		return
+	}
+	he, ok := err.(aicode.HTTPError)
+	if !ok {
+		he = aicode.ComInnerError
+	}
+	status := StatusCode(he.Code())
+	if c.Request().Method == HEAD {
+		c.NoContent(status)
+		return
+	}
+	c.JSON(status, he)
+}
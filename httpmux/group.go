@@ -0,0 +1,89 @@
+package httpmux
+
+import (
+	"aicode"
+)
+
+// Group is a set of routes sharing a path prefix and middleware.
+type Group struct {
+	prefix     string
+	middleware []Middleware
+	parent     *Group
+	srv        *server
+}
+
+// Group creates a route group with the given prefix. The group middleware runs
+// after the global middleware and before the route middleware.
+func (r *server) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{prefix: prefix, middleware: middleware, srv: r}
+}
+
+// Group creates a nested group. Its prefix is appended to the parent prefix
+// and its middleware runs after the parent group middleware.
+func (g *Group) Group(prefix string, middleware ...Middleware) *Group {
+	return &Group{prefix: g.prefix + prefix, middleware: middleware, parent: g, srv: g.srv}
+}
+
+// Use adds middleware to the group. Like server.Use, it also applies to routes
+// registered on the group before Use is called.
+func (g *Group) Use(middleware ...Middleware) {
+	g.middleware = append(g.middleware, middleware...)
+}
+
+// Prefix returns the full path prefix of the group.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// apply wraps h with the middleware of g and all of its parents, the outermost
+// group first.
+func (g *Group) apply(h Handle) Handle {
+	for ; g != nil; g = g.parent {
+		h = applyMiddleware(h, g.middleware...)
+	}
+	return h
+}
+
+// GET is a shortcut for group.Handle("GET", path, handle)
+func (g *Group) GET(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(GET, path, handle, middleware...)
+}
+
+// HEAD is a shortcut for group.Handle("HEAD", path, handle)
+func (g *Group) HEAD(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(HEAD, path, handle, middleware...)
+}
+
+// OPTIONS is a shortcut for group.Handle("OPTIONS", path, handle)
+func (g *Group) OPTIONS(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(OPTIONS, path, handle, middleware...)
+}
+
+// POST is a shortcut for group.Handle("POST", path, handle)
+func (g *Group) POST(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(POST, path, handle, middleware...)
+}
+
+// PUT is a shortcut for group.Handle("PUT", path, handle)
+func (g *Group) PUT(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(PUT, path, handle, middleware...)
+}
+
+// PATCH is a shortcut for group.Handle("PATCH", path, handle)
+func (g *Group) PATCH(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(PATCH, path, handle, middleware...)
+}
+
+// DELETE is a shortcut for group.Handle("DELETE", path, handle)
+func (g *Group) DELETE(path string, handle Handle, middleware ...Middleware) *Route {
+	return g.Handle(DELETE, path, handle, middleware...)
+}
+
+// Handle registers a new request handle with the group prefix prepended to
+// path.
+func (g *Group) Handle(method, path string, handle Handle, middleware ...Middleware) *Route {
+	h := applyMiddleware(handle, middleware...)
+	return g.srv.Handle(method, g.prefix+path, func(c Context) aicode.HTTPError {
+		return g.apply(h)(c)
+	})
+}
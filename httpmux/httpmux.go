@@ -2,9 +2,11 @@ package httpmux
 
 import (
 	"aicode"
-	"fmt"
+	"logger"
+	"net"
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/julienschmidt/httprouter"
 )
@@ -42,6 +44,7 @@ const (
 	MIMETextPlainCharsetUTF8             = MIMETextPlain + "; " + charsetUTF8
 	MIMEMultipartForm                    = "multipart/form-data"
 	MIMEOctetStream                      = "application/octet-stream"
+	MIMETextEventStream                  = "text/event-stream"
 )
 
 const (
@@ -54,18 +57,24 @@ const (
 	HeaderAcceptEncoding      = "Accept-Encoding"
 	HeaderAllow               = "Allow"
 	HeaderAuthorization       = "Authorization"
+	HeaderCacheControl        = "Cache-Control"
 	HeaderContentDisposition  = "Content-Disposition"
 	HeaderContentEncoding     = "Content-Encoding"
 	HeaderContentLength       = "Content-Length"
+	HeaderContentRange        = "Content-Range"
 	HeaderContentType         = "Content-Type"
 	HeaderCookie              = "Cookie"
 	HeaderSetCookie           = "Set-Cookie"
 	HeaderIfModifiedSince     = "If-Modified-Since"
 	HeaderLastModified        = "Last-Modified"
+	HeaderLastEventID         = "Last-Event-ID"
+	HeaderETag                = "ETag"
 	HeaderLocation            = "Location"
+	HeaderRange               = "Range"
 	HeaderUpgrade             = "Upgrade"
 	HeaderVary                = "Vary"
 	HeaderWWWAuthenticate     = "WWW-Authenticate"
+	HeaderForwarded           = "Forwarded"
 	HeaderXForwardedFor       = "X-Forwarded-For"
 	HeaderXForwardedProto     = "X-Forwarded-Proto"
 	HeaderXForwardedProtocol  = "X-Forwarded-Protocol"
@@ -76,6 +85,7 @@ const (
 	HeaderXRequestID          = "X-Request-ID"
 	HeaderXRequestedWith      = "X-Requested-With"
 	HeaderServer              = "Server"
+	HeaderRetryAfter          = "Retry-After"
 	HeaderOrigin              = "Origin"
 
 	// Access control
@@ -88,23 +98,102 @@ const (
 	HeaderAccessControlExposeHeaders    = "Access-Control-Expose-Headers"
 	HeaderAccessControlMaxAge           = "Access-Control-Max-Age"
 
+	// Rate limit
+	HeaderXRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderXRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderXRateLimitReset     = "X-RateLimit-Reset"
+
 	// Security
 	HeaderStrictTransportSecurity = "Strict-Transport-Security"
 	HeaderXContentTypeOptions     = "X-Content-Type-Options"
 	HeaderXXSSProtection          = "X-XSS-Protection"
 	HeaderXFrameOptions           = "X-Frame-Options"
 	HeaderContentSecurityPolicy   = "Content-Security-Policy"
+	HeaderContentSecurityPolicyRO = "Content-Security-Policy-Report-Only"
+	HeaderReferrerPolicy          = "Referrer-Policy"
+	HeaderPermissionsPolicy       = "Permissions-Policy"
 	HeaderXCSRFToken              = "X-CSRF-Token"
 )
 
 type server struct {
-	router *httprouter.Router
-	pool   sync.Pool
+	router     *httprouter.Router
+	pool       sync.Pool
+	middleware []Middleware
+	routes     []*Route
+
+	// Binder is used by Context.Bind.
+	Binder Binder
+
+	// HTTPErrorHandler writes the errors returned by handles and passed to
+	// Context.Error.
+	HTTPErrorHandler HTTPErrorHandler
+
+	// Renderer is used by Context.Render.
+	Renderer Renderer
+
+	// Logger receives the panics recovered while serving requests.
+	// Default is logger.GetInstance().
+	Logger *logger.Ailog
+
+	// PanicReporter, if set, is called with every recovered panic, e.g.
+	// CrashDumpReporter to write crash dumps to disk.
+	PanicReporter PanicReporter
+
+	// WebSocket configures Context.WebSocket. Zero fields take their value
+	// from DefaultWebSocketConfig.
+	WebSocket WebSocketConfig
+
+	// SSEHeartbeat is the interval of the heartbeats sent by Context.SSE
+	// streams. Default is DefaultSSEHeartbeat.
+	SSEHeartbeat time.Duration
+
+	// MaxMultipartMemory is the part of a multipart form body kept in memory,
+	// the rest is stored in temporary files. Default is 32 MB, lowered to the
+	// BodyLimit of the request if smaller.
+	MaxMultipartMemory int64
+
+	// TrustedProxies are the networks of the proxies whose Forwarded,
+	// X-Forwarded-* and X-Real-IP headers are honoured by Context.RealIP and
+	// Context.Scheme. Default is none, so only the peer address and TLS state
+	// are used. See SetTrustedProxies.
+	TrustedProxies []*net.IPNet
+
+	// ReadTimeout, WriteTimeout and IdleTimeout configure the http.Server
+	// created by Start and StartTLS. Zero means no timeout.
+	ReadTimeout  time.Duration
+	WriteTimeout time.Duration
+	IdleTimeout  time.Duration
+
+	lifeMu        sync.Mutex
+	httpServer    *http.Server
+	listener      net.Listener
+	stopped       chan struct{}
+	startHooks    []func()
+	shutdownHooks []func()
 }
 
 func New() *server {
 	s := new(server)
 	s.router = httprouter.New()
+	s.Binder = NewBinder()
+	s.MaxMultipartMemory = defaultMemory
+	s.Logger = logger.GetInstance()
+	s.HTTPErrorHandler = DefaultHTTPErrorHandler
+	notFound := s.warpFunc("", func(c Context) aicode.HTTPError {
+		return aicode.ComNotExist
+	})
+	s.router.NotFound = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		notFound(w, req, nil)
+	})
+	// OPTIONS requests for registered routes run the global middleware, so
+	// that e.g. CORS can answer preflights.
+	options := s.warpFunc("", func(c Context) aicode.HTTPError {
+		c.NoContent(http.StatusNoContent)
+		return nil
+	})
+	s.router.GlobalOPTIONS = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		options(w, req, nil)
+	})
 	s.pool.New = func() interface{} {
 		return s.NewContext(nil, nil)
 	}
@@ -113,63 +202,89 @@ func New() *server {
 
 type Handle func(c Context) aicode.HTTPError
 
+// Middleware wraps the next Handle in the chain. It may run logic before and
+// after calling next, or return an aicode.HTTPError without calling next to
+// short-circuit the rest of the chain.
+type Middleware func(next Handle) Handle
+
+// Use adds global middleware which runs for every route, including routes
+// registered before Use is called.
+//
+// Middleware runs in the order it was added: global middleware first, then the
+// middleware passed when the route was registered, then the handle itself.
+func (r *server) Use(middleware ...Middleware) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// applyMiddleware wraps h with middleware so that middleware[0] is the
+// outermost one.
+func applyMiddleware(h Handle, middleware ...Middleware) Handle {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+	return h
+}
+
 func (r *server) NewContext(req *http.Request, rsp http.ResponseWriter) Context {
 	return &context{
 		request:  req,
 		response: NewResponse(rsp, r),
 		store:    make(map[string]interface{}),
+		mux:      r,
 	}
 }
-func (r *server) warpFunc(h Handle) func(http.ResponseWriter, *http.Request, httprouter.Params) {
-	return func(rsp http.ResponseWriter, req *http.Request, _ httprouter.Params) {
+func (r *server) warpFunc(path string, h Handle) func(http.ResponseWriter, *http.Request, httprouter.Params) {
+	return func(rsp http.ResponseWriter, req *http.Request, ps httprouter.Params) {
 		c := r.pool.Get().(*context)
 		c.Reset(req, rsp)
+		c.path = path
+		c.setParams(ps)
 		defer func() {
 			if rc := recover(); rc != nil {
-				c.JSON(http.StatusOK, aicode.NewHTTPError(aicode.ComInnerError.Code(), fmt.Sprint(rc)))
+				r.recoverPanic(c, rc)
 			}
 		}()
-		err := h(c)
+		err := applyMiddleware(h, r.middleware...)(c)
 		if err != nil {
-			c.JSON(http.StatusOK, err)
+			c.Error(err)
 		}
 
 	}
 }
 
 // GET is a shortcut for router.Handle("GET", path, handle)
-func (r *server) GET(path string, handle Handle) {
-	r.router.Handle("GET", path, r.warpFunc(handle))
+func (r *server) GET(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(GET, path, handle, middleware...)
 }
 
 // HEAD is a shortcut for router.Handle("HEAD", path, handle)
-func (r *server) HEAD(path string, handle Handle) {
-	r.router.Handle("HEAD", path, r.warpFunc(handle))
+func (r *server) HEAD(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(HEAD, path, handle, middleware...)
 }
 
 // OPTIONS is a shortcut for router.Handle("OPTIONS", path, handle)
-func (r *server) OPTIONS(path string, handle Handle) {
-	r.router.Handle("OPTIONS", path, r.warpFunc(handle))
+func (r *server) OPTIONS(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(OPTIONS, path, handle, middleware...)
 }
 
 // POST is a shortcut for router.Handle("POST", path, handle)
-func (r *server) POST(path string, handle Handle) {
-	r.router.Handle("POST", path, r.warpFunc(handle))
+func (r *server) POST(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(POST, path, handle, middleware...)
 }
 
 // PUT is a shortcut for router.Handle("PUT", path, handle)
-func (r *server) PUT(path string, handle Handle) {
-	r.router.Handle("PUT", path, r.warpFunc(handle))
+func (r *server) PUT(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(PUT, path, handle, middleware...)
 }
 
 // PATCH is a shortcut for router.Handle("PATCH", path, handle)
-func (r *server) PATCH(path string, handle Handle) {
-	r.router.Handle("PATCH", path, r.warpFunc(handle))
+func (r *server) PATCH(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(PATCH, path, handle, middleware...)
 }
 
 // DELETE is a shortcut for router.Handle("DELETE", path, handle)
-func (r *server) DELETE(path string, handle Handle) {
-	r.router.Handle("DELETE", path, r.warpFunc(handle))
+func (r *server) DELETE(path string, handle Handle, middleware ...Middleware) *Route {
+	return r.Handle(DELETE, path, handle, middleware...)
 }
 
 // Handle registers a new request handle with the given path and method.
@@ -180,8 +295,21 @@ func (r *server) DELETE(path string, handle Handle) {
 // This function is intended for bulk loading and to allow the usage of less
 // frequently used, non-standardized or custom methods (e.g. for internal
 // communication with a proxy).
-func (r *server) Handle(method, path string, handle Handle) {
-	r.router.Handle(method, path, r.warpFunc(handle))
+//
+// The optional middleware only applies to this route and runs after the global
+// middleware registered with Use.
+//
+// The returned Route can be documented for the OpenAPI document.
+func (r *server) Handle(method, path string, handle Handle, middleware ...Middleware) *Route {
+	r.router.Handle(method, path, r.warpFunc(path, applyMiddleware(handle, middleware...)))
+	rt := &Route{Method: method, Path: path}
+	r.routes = append(r.routes, rt)
+	return rt
+}
+
+// Routes returns the registered routes in registration order.
+func (r *server) Routes() []*Route {
+	return r.routes
 }
 
 func (s *server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
@@ -4,6 +4,8 @@ import (
 	"aicode"
 	"log"
 	"net/http"
+	"net/http/httptest"
+	"strings"
 	"testing"
 )
 
@@ -32,5 +34,132 @@ func Test_Http(t *testing.T) {
 	srv := New()
 	srv.POST("/", Index)
 
-	http.ListenAndServe(":9000", srv)
+	req := httptest.NewRequest(POST, "/", strings.NewReader(`{"chan":"asr"}`))
+	req.Header.Set(HeaderContentType, MIMEApplicationJSON)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), "90005") {
+		t.Errorf("status %d, body %q", rec.Code, rec.Body.String())
+	}
+}
+
+func Test_Middleware(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next Handle) Handle {
+			return func(c Context) aicode.HTTPError {
+				trace = append(trace, name+">")
+				err := next(c)
+				trace = append(trace, "<"+name)
+				return err
+			}
+		}
+	}
+	deny := func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			return aicode.ComUnAuthorized
+		}
+	}
+
+	srv := New()
+	srv.Use(mark("g1"), mark("g2"))
+	srv.GET("/", func(c Context) aicode.HTTPError {
+		trace = append(trace, "handle")
+		return nil
+	}, mark("r1"))
+	srv.GET("/deny", func(c Context) aicode.HTTPError {
+		t.Error("handle should not be called")
+		return nil
+	}, deny)
+
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/", nil))
+	if got, want := strings.Join(trace, " "), "g1> g2> r1> handle <r1 <g2 <g1"; got != want {
+		t.Errorf("middleware order %q, want %q", got, want)
+	}
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/deny", nil))
+	if !strings.Contains(rec.Body.String(), "90003") {
+		t.Errorf("short-circuit body %q", rec.Body.String())
+	}
+}
+
+func Test_Group(t *testing.T) {
+	var trace []string
+	mark := func(name string) Middleware {
+		return func(next Handle) Handle {
+			return func(c Context) aicode.HTTPError {
+				trace = append(trace, name)
+				return next(c)
+			}
+		}
+	}
+
+	srv := New()
+	api := srv.Group("/api", mark("api"))
+	v1 := api.Group("/v1", mark("v1"))
+	v1.GET("/stream", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, "stream")
+		return nil
+	}, mark("route"))
+	v1.Use(mark("late"))
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/api/v1/stream", nil))
+	if rec.Body.String() != "stream" {
+		t.Fatalf("body %q", rec.Body.String())
+	}
+	if got, want := strings.Join(trace, " "), "api v1 late route"; got != want {
+		t.Errorf("middleware order %q, want %q", got, want)
+	}
+}
+
+func Test_Params(t *testing.T) {
+	srv := New()
+	srv.Group("/stream").GET("/:id/*file", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, c.Path()+" "+c.Param("id")+" "+c.Param("file")+" "+strings.Join(c.ParamNames(), ","))
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/stream/42/a/b.wav", nil))
+	if got, want := rec.Body.String(), "/stream/:id/*file 42 /a/b.wav id,file"; got != want {
+		t.Errorf("body %q, want %q", got, want)
+	}
+}
+
+func Test_HTTPErrorHandler(t *testing.T) {
+	srv := New()
+	srv.GET("/limit", func(c Context) aicode.HTTPError {
+		return aicode.ComLimit
+	})
+	srv.GET("/panic", func(c Context) aicode.HTTPError {
+		panic("boom")
+	})
+
+	tests := []struct {
+		target string
+		status int
+		code   string
+	}{
+		{"/limit", http.StatusTooManyRequests, "90007"},
+		{"/panic", http.StatusInternalServerError, "90001"},
+		{"/missing", http.StatusNotFound, "90002"},
+	}
+	for _, tt := range tests {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(GET, tt.target, nil))
+		if rec.Code != tt.status || !strings.Contains(rec.Body.String(), tt.code) {
+			t.Errorf("%s: status %d body %q", tt.target, rec.Code, rec.Body.String())
+		}
+	}
+
+	srv.HTTPErrorHandler = func(err error, c Context) {
+		c.String(http.StatusTeapot, err.Error())
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/limit", nil))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("custom handler status %d", rec.Code)
+	}
 }
@@ -0,0 +1,147 @@
+package httpmuxtest
+
+import (
+	"bytes"
+	"encoding/json"
+	"httpmux"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+type (
+	// Client sends requests to an http.Handler in-process. Cookies set by
+	// responses are kept and sent with the following requests, like a browser
+	// would.
+	Client struct {
+		t       testing.TB
+		handler http.Handler
+		header  http.Header
+		jar     *cookiejar.Jar
+	}
+
+	// Request is a request being built by a Client.
+	Request struct {
+		cl     *Client
+		method string
+		target string
+		query  url.Values
+		header http.Header
+		body   io.Reader
+	}
+)
+
+// NewClient returns a client sending requests to h, usually a server
+// returned by httpmux.New.
+func NewClient(t testing.TB, h http.Handler) *Client {
+	jar, _ := cookiejar.New(nil)
+	return &Client{t: t, handler: h, header: http.Header{}, jar: jar}
+}
+
+// SetHeader sets a header sent with every request of the client.
+func (cl *Client) SetHeader(key, value string) *Client {
+	cl.header.Set(key, value)
+	return cl
+}
+
+// Cookie returns the value of the cookie kept for path, or "".
+func (cl *Client) Cookie(path, name string) string {
+	for _, c := range cl.jar.Cookies(cl.url(path)) {
+		if c.Name == name {
+			return c.Value
+		}
+	}
+	return ""
+}
+
+func (cl *Client) url(target string) *url.URL {
+	u, _ := url.Parse("http://example.com" + target)
+	return u
+}
+
+// GET starts a GET request for target, a path with an optional query.
+func (cl *Client) GET(target string) *Request { return cl.NewRequest(httpmux.GET, target) }
+
+// HEAD starts a HEAD request for target.
+func (cl *Client) HEAD(target string) *Request { return cl.NewRequest(httpmux.HEAD, target) }
+
+// OPTIONS starts an OPTIONS request for target.
+func (cl *Client) OPTIONS(target string) *Request { return cl.NewRequest(httpmux.OPTIONS, target) }
+
+// POST starts a POST request for target.
+func (cl *Client) POST(target string) *Request { return cl.NewRequest(httpmux.POST, target) }
+
+// PUT starts a PUT request for target.
+func (cl *Client) PUT(target string) *Request { return cl.NewRequest(httpmux.PUT, target) }
+
+// PATCH starts a PATCH request for target.
+func (cl *Client) PATCH(target string) *Request { return cl.NewRequest(httpmux.PATCH, target) }
+
+// DELETE starts a DELETE request for target.
+func (cl *Client) DELETE(target string) *Request { return cl.NewRequest(httpmux.DELETE, target) }
+
+// NewRequest starts a request with method for target.
+func (cl *Client) NewRequest(method, target string) *Request {
+	return &Request{cl: cl, method: method, target: target, query: url.Values{}, header: cl.header.Clone()}
+}
+
+// Header sets a request header.
+func (r *Request) Header(key, value string) *Request {
+	r.header.Set(key, value)
+	return r
+}
+
+// Query adds a query parameter.
+func (r *Request) Query(key, value string) *Request {
+	r.query.Add(key, value)
+	return r
+}
+
+// Body sets the request body and its content type.
+func (r *Request) Body(contentType string, body []byte) *Request {
+	r.header.Set(httpmux.HeaderContentType, contentType)
+	r.body = bytes.NewReader(body)
+	return r
+}
+
+// JSON sets the request body to the JSON encoding of v.
+func (r *Request) JSON(v interface{}) *Request {
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.cl.t.Fatalf("encode request JSON: %v", err)
+	}
+	return r.Body(httpmux.MIMEApplicationJSONCharsetUTF8, b)
+}
+
+// Form sets the request body to the URL encoded form values.
+func (r *Request) Form(values url.Values) *Request {
+	return r.Body(httpmux.MIMEApplicationForm, []byte(values.Encode()))
+}
+
+// Do sends the request and returns the recorded response.
+func (r *Request) Do() *Response {
+	r.cl.t.Helper()
+	target := r.target
+	if len(r.query) > 0 {
+		sep := "?"
+		if strings.Contains(target, "?") {
+			sep = "&"
+		}
+		target += sep + r.query.Encode()
+	}
+	req := httptest.NewRequest(r.method, target, r.body)
+	req.Header = r.header
+	u := r.cl.url(target)
+	for _, c := range r.cl.jar.Cookies(u) {
+		req.AddCookie(c)
+	}
+
+	rec := httptest.NewRecorder()
+	r.cl.handler.ServeHTTP(rec, req)
+	r.cl.jar.SetCookies(u, rec.Result().Cookies())
+	return &Response{Recorder: rec, t: r.cl.t}
+}
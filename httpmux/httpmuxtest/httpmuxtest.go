@@ -0,0 +1,201 @@
+// Package httpmuxtest provides utilities for testing httpmux handles and
+// servers without opening a network listener.
+//
+// Invoke runs a single Handle on a Context built from an httptest request:
+//
+//	srv := httpmux.New()
+//	req := httptest.NewRequest(httpmux.GET, "/stream/1", nil)
+//	res := httpmuxtest.Invoke(t, srv, getStream, req, httpmuxtest.Route("/stream/:id", "1"))
+//	res.Returned(nil)
+//	res.Status(http.StatusOK).JSON(map[string]string{"id": "1"})
+//
+// Client sends requests through a whole server, middleware and routing
+// included:
+//
+//	cl := httpmuxtest.NewClient(t, srv)
+//	cl.POST("/stream/1").JSON(body).Do().Status(http.StatusTooManyRequests).Code(aicode.ComLimit)
+package httpmuxtest
+
+import (
+	"aicode"
+	"bytes"
+	"encoding/json"
+	"httpmux"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type (
+	// Server builds contexts for its requests. It is implemented by the server
+	// returned by httpmux.New.
+	Server interface {
+		http.Handler
+		NewContext(req *http.Request, rsp http.ResponseWriter) httpmux.Context
+	}
+
+	// Option prepares the Context passed to the handle by Invoke.
+	Option func(c httpmux.Context)
+
+	// Response is a recorded response with chainable assertions. A failed
+	// assertion reports an error on the test and the test goes on.
+	Response struct {
+		Recorder *httptest.ResponseRecorder
+		t        testing.TB
+	}
+
+	// Result is the outcome of Invoke.
+	Result struct {
+		*Response
+
+		// Context is the context the handle ran with.
+		Context httpmux.Context
+
+		// Err is the error returned by the handle.
+		Err aicode.HTTPError
+	}
+)
+
+// Route sets the registered path of the Context, as pattern, and its path
+// parameters to values, in the order they appear in pattern.
+func Route(pattern string, values ...string) Option {
+	return func(c httpmux.Context) {
+		var names []string
+		for _, s := range strings.Split(pattern, "/") {
+			if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+				names = append(names, s[1:])
+			}
+		}
+		if len(values) != len(names) {
+			panic("httpmuxtest: route " + pattern + " does not match the number of values")
+		}
+		c.SetPath(pattern)
+		c.SetParamNames(names...)
+		c.SetParamValues(values...)
+	}
+}
+
+// Store saves val in the Context under key, as a middleware would.
+func Store(key string, val interface{}) Option {
+	return func(c httpmux.Context) {
+		c.Set(key, val)
+	}
+}
+
+// Invoke runs h on a Context built by srv for req, after applying opts. The
+// server middleware does not run. An error returned by h is kept in
+// Result.Err and then passed to Context.Error, so that the response is the
+// one the server would send.
+func Invoke(t testing.TB, srv Server, h httpmux.Handle, req *http.Request, opts ...Option) *Result {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	c := srv.NewContext(req, rec)
+	for _, opt := range opts {
+		opt(c)
+	}
+	err := h(c)
+	if err != nil {
+		c.Error(err)
+	}
+	return &Result{Response: &Response{Recorder: rec, t: t}, Context: c, Err: err}
+}
+
+// Returned asserts that the handle returned an error with the code of want,
+// or no error when want is nil.
+func (r *Result) Returned(want aicode.HTTPError) *Result {
+	r.t.Helper()
+	switch {
+	case want == nil && r.Err != nil:
+		r.t.Errorf("handle returned %d %s, want no error", r.Err.Code(), r.Err.Msg())
+	case want != nil && r.Err == nil:
+		r.t.Errorf("handle returned no error, want %d %s", want.Code(), want.Msg())
+	case want != nil && r.Err.Code() != want.Code():
+		r.t.Errorf("handle returned %d %s, want %d %s", r.Err.Code(), r.Err.Msg(), want.Code(), want.Msg())
+	}
+	return r
+}
+
+// Status asserts the response status code.
+func (r *Response) Status(code int) *Response {
+	r.t.Helper()
+	if r.Recorder.Code != code {
+		r.t.Errorf("status %d, want %d; body %q", r.Recorder.Code, code, r.Recorder.Body.String())
+	}
+	return r
+}
+
+// Header asserts the value of a response header.
+func (r *Response) Header(key, value string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Header().Get(key); got != value {
+		r.t.Errorf("header %s %q, want %q", key, got, value)
+	}
+	return r
+}
+
+// Body asserts the response body.
+func (r *Response) Body(body string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); got != body {
+		r.t.Errorf("body %q, want %q", got, body)
+	}
+	return r
+}
+
+// BodyContains asserts that the response body contains s.
+func (r *Response) BodyContains(s string) *Response {
+	r.t.Helper()
+	if got := r.Recorder.Body.String(); !strings.Contains(got, s) {
+		r.t.Errorf("body %q lacks %q", got, s)
+	}
+	return r
+}
+
+// JSON asserts that the response body is the JSON encoding of v. Objects are
+// compared regardless of key order and formatting.
+func (r *Response) JSON(v interface{}) *Response {
+	r.t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		r.t.Fatalf("encode expected JSON: %v", err)
+	}
+	var want, got interface{}
+	json.Unmarshal(b, &want)
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), &got); err != nil {
+		r.t.Errorf("body %q is not JSON: %v", r.Recorder.Body.String(), err)
+		return r
+	}
+	if !reflect.DeepEqual(got, want) {
+		r.t.Errorf("JSON body %s, want %s", bytes.TrimSpace(r.Recorder.Body.Bytes()), b)
+	}
+	return r
+}
+
+// DecodeJSON decodes the JSON response body into v.
+func (r *Response) DecodeJSON(v interface{}) *Response {
+	r.t.Helper()
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), v); err != nil {
+		r.t.Errorf("decode body %q: %v", r.Recorder.Body.String(), err)
+	}
+	return r
+}
+
+// Code asserts that the body is the `{code,msg}` JSON of an aicode error with
+// the code of want.
+func (r *Response) Code(want aicode.HTTPError) *Response {
+	r.t.Helper()
+	var got struct {
+		Code *int   `json:"code"`
+		Msg  string `json:"msg"`
+	}
+	if err := json.Unmarshal(r.Recorder.Body.Bytes(), &got); err != nil || got.Code == nil {
+		r.t.Errorf("body %q is not an aicode error, want %d %s", r.Recorder.Body.String(), want.Code(), want.Msg())
+		return r
+	}
+	if *got.Code != want.Code() {
+		r.t.Errorf("error %d %s, want %d %s", *got.Code, got.Msg, want.Code(), want.Msg())
+	}
+	return r
+}
@@ -0,0 +1,76 @@
+package httpmuxtest
+
+import (
+	"aicode"
+	"httpmux"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+type stream struct {
+	ID   string `json:"id" param:"id"`
+	Lang string `json:"lang" query:"lang"`
+}
+
+func getStream(c httpmux.Context) aicode.HTTPError {
+	s := new(stream)
+	if err := c.Bind(s); err != nil {
+		return aicode.ComBadParam
+	}
+	if s.ID == "busy" {
+		return aicode.ComLimit
+	}
+	c.Response().Header().Set("X-Stream", s.ID)
+	c.JSON(http.StatusOK, s)
+	return nil
+}
+
+func Test_Invoke(t *testing.T) {
+	srv := httpmux.New()
+	req := httptest.NewRequest(httpmux.GET, "/stream/1?lang=zh", nil)
+	res := Invoke(t, srv, getStream, req, Route("/stream/:id", "1"))
+	res.Returned(nil)
+	res.Status(http.StatusOK).Header("X-Stream", "1").JSON(map[string]string{"lang": "zh", "id": "1"})
+	if res.Context.Path() != "/stream/:id" {
+		t.Errorf("path %q", res.Context.Path())
+	}
+
+	req = httptest.NewRequest(httpmux.GET, "/stream/busy", nil)
+	res = Invoke(t, srv, getStream, req, Route("/stream/:id", "busy"))
+	res.Returned(aicode.ComLimit)
+	res.Status(http.StatusTooManyRequests).Code(aicode.ComLimit)
+}
+
+func Test_Client(t *testing.T) {
+	srv := httpmux.New()
+	srv.GET("/stream/:id", getStream)
+	srv.POST("/login", func(c httpmux.Context) aicode.HTTPError {
+		http.SetCookie(c.Response(), &http.Cookie{Name: "sid", Value: c.FormValue("user"), Path: "/"})
+		c.NoContent(http.StatusNoContent)
+		return nil
+	})
+	srv.GET("/whoami", func(c httpmux.Context) aicode.HTTPError {
+		sid, err := c.Request().Cookie("sid")
+		if err != nil {
+			return aicode.ComUnAuthorized
+		}
+		c.String(http.StatusOK, sid.Value+" "+c.Request().Header.Get("X-App"))
+		return nil
+	})
+
+	cl := NewClient(t, srv).SetHeader("X-App", "asr")
+	cl.GET("/stream/2").Query("lang", "en").Do().
+		Status(http.StatusOK).
+		Header(httpmux.HeaderContentType, httpmux.MIMEApplicationJSONCharsetUTF8).
+		JSON(stream{ID: "2", Lang: "en"})
+	cl.GET("/missing").Do().Status(http.StatusNotFound).Code(aicode.ComNotExist)
+	cl.GET("/whoami").Do().Status(http.StatusUnauthorized)
+
+	cl.POST("/login").Form(url.Values{"user": {"alice"}}).Do().Status(http.StatusNoContent)
+	if sid := cl.Cookie("/", "sid"); sid != "alice" {
+		t.Errorf("kept cookie %q", sid)
+	}
+	cl.GET("/whoami").Do().Status(http.StatusOK).Body("alice asr")
+}
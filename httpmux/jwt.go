@@ -0,0 +1,446 @@
+package httpmux
+
+import (
+	"aicode"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type (
+	// Claims are the claims of a verified token.
+	Claims map[string]interface{}
+
+	// TokenValidator verifies a bearer token and returns its claims. It
+	// returns aicode.ComUnAuthorized for invalid tokens and
+	// aicode.ComAuthExpired for expired ones.
+	TokenValidator func(c Context, token string) (Claims, aicode.HTTPError)
+
+	// JWTConfig defines the config for JWT middleware.
+	JWTConfig struct {
+		// Header is the header carrying the token as "Bearer <token>".
+		// Default is HeaderAuthorization.
+		Header string
+
+		// Query and Cookie name a query parameter and a cookie carrying the
+		// token, looked up in that order when the header is absent. Empty
+		// disables them.
+		Query  string
+		Cookie string
+
+		// Key verifies tokens without a "kid" header, or with a key ID missing
+		// from Keys when there is no JWKSURL: a []byte HMAC secret, an
+		// *rsa.PublicKey or an *ecdsa.PublicKey.
+		Key interface{}
+
+		// Keys verify tokens by their "kid" header.
+		Keys map[string]interface{}
+
+		// JWKSURL is a JSON Web Key Set fetched for the keys missing from Keys.
+		JWKSURL string
+
+		// JWKSRefresh is how long fetched keys are cached. Unknown key IDs
+		// trigger an earlier refresh, at most once a minute.
+		// Default is 1 hour.
+		JWKSRefresh time.Duration
+
+		// HTTPClient fetches JWKSURL. Default is a client with a 10 seconds
+		// timeout.
+		HTTPClient *http.Client
+
+		// Methods are the accepted signing algorithms, e.g. "RS256". Default
+		// accepts the algorithms of the key type.
+		Methods []string
+
+		// Issuer and Audience, when set, must match the "iss" and "aud" claims.
+		Issuer   string
+		Audience string
+
+		// Leeway tolerates clock skew when checking "exp" and "nbf".
+		Leeway time.Duration
+
+		// Validator, when set, verifies tokens instead of JWT parsing, e.g. to
+		// introspect opaque tokens.
+		Validator TokenValidator
+	}
+
+	// jwks caches the keys of a JSON Web Key Set.
+	jwks struct {
+		url     string
+		client  *http.Client
+		refresh time.Duration
+		mu      sync.Mutex
+		keys    map[string]interface{}
+		fetched time.Time
+
+		// attempted is when the last fetch started, err how it ended, and
+		// fetching is closed when the running fetch ends.
+		attempted time.Time
+		err       error
+		fetching  chan struct{}
+	}
+)
+
+const claimsKey = "httpmux.claims"
+
+// jwksMinRefresh limits the refreshes triggered by unknown key IDs and failed
+// fetches.
+const jwksMinRefresh = time.Minute
+
+// DefaultJWTConfig is the default JWT middleware config.
+var DefaultJWTConfig = JWTConfig{
+	Header:      HeaderAuthorization,
+	JWKSRefresh: time.Hour,
+}
+
+// JWT returns a middleware which requires a bearer JWT verified with key, a
+// []byte HMAC secret, an *rsa.PublicKey or an *ecdsa.PublicKey.
+func JWT(key interface{}) Middleware {
+	config := DefaultJWTConfig
+	config.Key = key
+	return JWTWithConfig(config)
+}
+
+// JWTWithConfig returns a JWT middleware with config. See JWT.
+//
+// The claims of the token are stored in the Context, see ClaimsFrom. Requests
+// without a valid token are rejected with aicode.ComUnAuthorized, or
+// aicode.ComAuthExpired when the token expired.
+func JWTWithConfig(config JWTConfig) Middleware {
+	if config.Header == "" {
+		config.Header = DefaultJWTConfig.Header
+	}
+	if config.JWKSRefresh == 0 {
+		config.JWKSRefresh = DefaultJWTConfig.JWKSRefresh
+	}
+	if config.HTTPClient == nil {
+		config.HTTPClient = &http.Client{Timeout: 10 * time.Second}
+	}
+	validate := config.Validator
+	if validate == nil {
+		var set *jwks
+		if config.JWKSURL != "" {
+			set = &jwks{url: config.JWKSURL, client: config.HTTPClient, refresh: config.JWKSRefresh}
+		}
+		validate = func(c Context, token string) (Claims, aicode.HTTPError) {
+			return config.parse(token, set)
+		}
+	}
+
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			token := config.extract(c)
+			if token == "" {
+				c.Response().Header().Set(HeaderWWWAuthenticate, "Bearer")
+				return aicode.ComUnAuthorized
+			}
+			claims, err := validate(c, token)
+			if err != nil {
+				c.Response().Header().Set(HeaderWWWAuthenticate, `Bearer error="invalid_token"`)
+				return err
+			}
+			c.Set(claimsKey, claims)
+			return next(c)
+		}
+	}
+}
+
+// RequireScopes returns a middleware which rejects requests whose token
+// lacks one of scopes with aicode.ComAuthFailed. Scopes are read from the
+// "scope" claim, a space separated string, or the "scp" or "scopes" claim, a
+// list. It must run after JWT middleware.
+func RequireScopes(scopes ...string) Middleware {
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			claims := ClaimsFrom(c)
+			if claims == nil {
+				return aicode.ComUnAuthorized
+			}
+			granted := claims.Scopes()
+			for _, want := range scopes {
+				if !containsString(granted, want) {
+					c.Response().Header().Set(HeaderWWWAuthenticate,
+						fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+					return aicode.ComAuthFailed
+				}
+			}
+			return next(c)
+		}
+	}
+}
+
+// ClaimsFrom returns the claims stored by the JWT middleware, or nil.
+func ClaimsFrom(c Context) Claims {
+	claims, _ := c.Get(claimsKey).(Claims)
+	return claims
+}
+
+// Subject returns the "sub" claim.
+func (cl Claims) Subject() string {
+	sub, _ := cl["sub"].(string)
+	return sub
+}
+
+// Scopes returns the scopes granted to the token.
+func (cl Claims) Scopes() []string {
+	if s, ok := cl["scope"].(string); ok {
+		return strings.Fields(s)
+	}
+	for _, key := range []string{"scp", "scopes"} {
+		switch v := cl[key].(type) {
+		case string:
+			return strings.Fields(v)
+		case []interface{}:
+			scopes := make([]string, 0, len(v))
+			for _, s := range v {
+				if s, ok := s.(string); ok {
+					scopes = append(scopes, s)
+				}
+			}
+			return scopes
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// extract returns the token of the request, or "".
+func (config *JWTConfig) extract(c Context) string {
+	req := c.Request()
+	if auth := req.Header.Get(config.Header); auth != "" {
+		if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+			return strings.TrimSpace(auth[7:])
+		}
+		return ""
+	}
+	if config.Query != "" {
+		if token := c.QueryParam(config.Query); token != "" {
+			return token
+		}
+	}
+	if config.Cookie != "" {
+		if ck, err := req.Cookie(config.Cookie); err == nil {
+			return ck.Value
+		}
+	}
+	return ""
+}
+
+// parse verifies a JWT with the configured keys and checks its claims.
+func (config *JWTConfig) parse(token string, set *jwks) (Claims, aicode.HTTPError) {
+	parser := &jwt.Parser{ValidMethods: config.Methods, SkipClaimsValidation: true}
+	claims := jwt.MapClaims{}
+	_, err := parser.ParseWithClaims(token, claims, func(t *jwt.Token) (interface{}, error) {
+		key, err := config.key(t, set)
+		if err != nil {
+			return nil, err
+		}
+		if !methodFitsKey(t.Method, key) {
+			return nil, fmt.Errorf("signing method %s does not fit the key", t.Method.Alg())
+		}
+		return key, nil
+	})
+	if err != nil {
+		return nil, aicode.ComUnAuthorized
+	}
+
+	now := time.Now()
+	if exp, ok := numericClaim(claims, "exp"); ok && now.After(exp.Add(config.Leeway)) {
+		return nil, aicode.ComAuthExpired
+	}
+	if nbf, ok := numericClaim(claims, "nbf"); ok && now.Add(config.Leeway).Before(nbf) {
+		return nil, aicode.ComUnAuthorized
+	}
+	if config.Issuer != "" && claims["iss"] != config.Issuer {
+		return nil, aicode.ComUnAuthorized
+	}
+	if config.Audience != "" && !audienceMatches(claims["aud"], config.Audience) {
+		return nil, aicode.ComUnAuthorized
+	}
+	return Claims(claims), nil
+}
+
+// key returns the key verifying t: the key of its "kid" header, or Key when
+// the token has no key ID or the ID is unknown without a key set.
+func (config *JWTConfig) key(t *jwt.Token, set *jwks) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid != "" {
+		if key, ok := config.Keys[kid]; ok {
+			return key, nil
+		}
+		if set != nil {
+			return set.key(kid)
+		}
+	}
+	if config.Key == nil {
+		return nil, fmt.Errorf("no key for key ID %q", kid)
+	}
+	return config.Key, nil
+}
+
+// methodFitsKey rejects tokens whose algorithm does not match the key type,
+// such as an HMAC token signed with an RSA public key.
+func methodFitsKey(m jwt.SigningMethod, key interface{}) bool {
+	switch m.(type) {
+	case *jwt.SigningMethodHMAC:
+		_, ok := key.([]byte)
+		return ok
+	case *jwt.SigningMethodRSA, *jwt.SigningMethodRSAPSS:
+		_, ok := key.(*rsa.PublicKey)
+		return ok
+	case *jwt.SigningMethodECDSA:
+		_, ok := key.(*ecdsa.PublicKey)
+		return ok
+	}
+	return false
+}
+
+func numericClaim(claims jwt.MapClaims, name string) (time.Time, bool) {
+	switch v := claims[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+func audienceMatches(aud interface{}, want string) bool {
+	switch v := aud.(type) {
+	case string:
+		return v == want
+	case []interface{}:
+		for _, a := range v {
+			if a == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// key returns the key with kid, fetching the set when the cache is stale or
+// does not know kid. Concurrent callers wait for a single fetch.
+func (s *jwks) key(kid string) (interface{}, error) {
+	s.mu.Lock()
+	key, ok := s.keys[kid]
+	switch {
+	case ok && time.Since(s.fetched) < s.refresh:
+	case (!ok || s.err != nil) && time.Since(s.attempted) < jwksMinRefresh:
+	case s.fetching != nil:
+		done := s.fetching
+		s.mu.Unlock()
+		<-done
+		s.mu.Lock()
+		key, ok = s.keys[kid]
+	default:
+		done := make(chan struct{})
+		s.fetching, s.attempted = done, time.Now()
+		s.mu.Unlock()
+		keys, err := s.fetch()
+		s.mu.Lock()
+		if err == nil {
+			s.keys, s.fetched = keys, time.Now()
+		}
+		s.err, s.fetching = err, nil
+		close(done)
+		key, ok = s.keys[kid]
+	}
+	err := s.err
+	s.mu.Unlock()
+
+	if ok {
+		// Keep serving the cached key while the set is unreachable.
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("unknown key ID %q", kid)
+}
+
+func (s *jwks) fetch() (map[string]interface{}, error) {
+	rsp, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer rsp.Body.Close()
+	if rsp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetch %s: status %d", s.url, rsp.StatusCode)
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.NewDecoder(rsp.Body).Decode(&set); err != nil {
+		return nil, fmt.Errorf("decode %s: %v", s.url, err)
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Kid == "" || (k.Use != "" && k.Use != "sig") {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, e := decodeBigInt(k.N), decodeBigInt(k.E)
+			if n == nil || e == nil || !e.IsInt64() {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, y := decodeBigInt(k.X), decodeBigInt(k.Y)
+			if x == nil || y == nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	return keys, nil
+}
+
+func decodeBigInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+	return new(big.Int).SetBytes(b)
+}
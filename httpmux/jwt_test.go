@@ -0,0 +1,171 @@
+package httpmux
+
+import (
+	"aicode"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+func Test_JWT(t *testing.T) {
+	secret := []byte("secret")
+	sign := func(m jwt.SigningMethod, key interface{}, kid string, claims jwt.MapClaims) string {
+		tok := jwt.NewWithClaims(m, claims)
+		if kid != "" {
+			tok.Header["kid"] = kid
+		}
+		s, err := tok.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	srv := New()
+	srv.Use(JWTWithConfig(JWTConfig{Key: secret, Cookie: "token", Audience: "asr"}))
+	srv.GET("/me", func(c Context) aicode.HTTPError {
+		c.String(http.StatusOK, ClaimsFrom(c).Subject())
+		return nil
+	})
+	srv.POST("/stream", func(c Context) aicode.HTTPError { return nil }, RequireScopes("asr:write"))
+
+	do := func(method, path, auth string, cookie bool) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if cookie {
+			req.AddCookie(&http.Cookie{Name: "token", Value: auth})
+		} else if auth != "" {
+			req.Header.Set(HeaderAuthorization, "Bearer "+auth)
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		return rec
+	}
+
+	good := sign(jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"sub": "u1", "aud": []string{"asr"}, "exp": exp, "scope": "asr:read"})
+	if rec := do(GET, "/me", good, false); rec.Code != http.StatusOK || rec.Body.String() != "u1" {
+		t.Errorf("valid token: %d %q", rec.Code, rec.Body.String())
+	}
+	if rec := do(GET, "/me", good, true); rec.Code != http.StatusOK {
+		t.Errorf("cookie token: %d", rec.Code)
+	}
+	if rec := do(POST, "/stream", good, false); rec.Code != http.StatusForbidden {
+		t.Errorf("missing scope: %d", rec.Code)
+	}
+	if rec := do(GET, "/me", "", false); rec.Code != http.StatusUnauthorized || rec.Header().Get(HeaderWWWAuthenticate) != "Bearer" {
+		t.Errorf("no token: %d %q", rec.Code, rec.Header().Get(HeaderWWWAuthenticate))
+	}
+	expired := sign(jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"aud": "asr", "exp": time.Now().Add(-time.Minute).Unix()})
+	if rec := do(GET, "/me", expired, false); rec.Code != http.StatusUnauthorized || !jsonHasCode(rec, aicode.ComAuthExpired) {
+		t.Errorf("expired token: %d %s", rec.Code, rec.Body)
+	}
+	wrongAud := sign(jwt.SigningMethodHS256, secret, "", jwt.MapClaims{"aud": "billing", "exp": exp})
+	if rec := do(GET, "/me", wrongAud, false); !jsonHasCode(rec, aicode.ComUnAuthorized) {
+		t.Errorf("wrong audience: %s", rec.Body)
+	}
+	forged := sign(jwt.SigningMethodHS256, []byte("other"), "", jwt.MapClaims{"aud": "asr", "exp": exp})
+	if rec := do(GET, "/me", forged, false); rec.Code != http.StatusUnauthorized {
+		t.Errorf("forged token: %d", rec.Code)
+	}
+}
+
+func Test_JWKS(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	ecKey, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	b64 := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	var fetches int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		json.NewEncoder(w).Encode(map[string]interface{}{"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa1", "use": "sig", "n": b64(rsaKey.N), "e": b64(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec1", "crv": "P-256", "x": b64(ecKey.X), "y": b64(ecKey.Y)},
+		}})
+	}))
+	defer jwksServer.Close()
+
+	srv := New()
+	srv.GET("/", func(c Context) aicode.HTTPError { return nil },
+		JWTWithConfig(JWTConfig{JWKSURL: jwksServer.URL, Query: "access_token"}))
+
+	sign := func(m jwt.SigningMethod, key interface{}, kid string) string {
+		tok := jwt.NewWithClaims(m, jwt.MapClaims{"sub": "u1"})
+		tok.Header["kid"] = kid
+		s, _ := tok.SignedString(key)
+		return s
+	}
+	for _, tc := range []struct {
+		token string
+		code  int
+	}{
+		{sign(jwt.SigningMethodRS256, rsaKey, "rsa1"), http.StatusOK},
+		{sign(jwt.SigningMethodES256, ecKey, "ec1"), http.StatusOK},
+		{sign(jwt.SigningMethodRS256, rsaKey, "ec1"), http.StatusUnauthorized},
+		{sign(jwt.SigningMethodRS256, rsaKey, "unknown"), http.StatusUnauthorized},
+	} {
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, httptest.NewRequest(GET, "/?access_token="+tc.token, nil))
+		if rec.Code != tc.code {
+			t.Errorf("status %d, want %d", rec.Code, tc.code)
+		}
+	}
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("key set fetched %d times", n)
+	}
+}
+
+func Test_JWKSUnreachable(t *testing.T) {
+	rsaKey, _ := rsa.GenerateKey(rand.Reader, 2048)
+	var fetches int32
+	jwksServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&fetches, 1)
+		time.Sleep(20 * time.Millisecond)
+		w.WriteHeader(http.StatusBadGateway)
+	}))
+	defer jwksServer.Close()
+
+	srv := New()
+	srv.GET("/", func(c Context) aicode.HTTPError { return nil },
+		JWTWithConfig(JWTConfig{JWKSURL: jwksServer.URL, Query: "access_token"}))
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "u1"})
+	tok.Header["kid"] = "rsa1"
+	token, _ := tok.SignedString(rsaKey)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(GET, "/?access_token="+token, nil))
+			if rec.Code != http.StatusUnauthorized {
+				t.Errorf("status %d", rec.Code)
+			}
+		}()
+	}
+	wg.Wait()
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/?access_token="+token, nil))
+	if n := atomic.LoadInt32(&fetches); n != 1 {
+		t.Errorf("key set fetched %d times", n)
+	}
+}
+
+func jsonHasCode(rec *httptest.ResponseRecorder, want aicode.HTTPError) bool {
+	var body struct {
+		Code int `json:"code"`
+	}
+	json.Unmarshal(rec.Body.Bytes(), &body)
+	return body.Code == want.Code()
+}
@@ -0,0 +1,236 @@
+package httpmux
+
+import (
+	"aicode"
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MIMETextPrometheus is the content type of the Prometheus text format.
+const MIMETextPrometheus = "text/plain; version=0.0.4; " + charsetUTF8
+
+type (
+	// MetricsConfig defines the config of Metrics.
+	MetricsConfig struct {
+		// Namespace prefixes the metric names, e.g. "asr" gives
+		// asr_http_requests_total. Default is no prefix.
+		Namespace string
+
+		// Buckets are the upper bounds in seconds of the latency histogram.
+		// Default is DefaultMetricsBuckets.
+		Buckets []float64
+	}
+
+	// Metrics records request counts, latency histograms and in-flight
+	// gauges, labeled by method, route pattern, HTTP status and aicode code,
+	// and exposes them in the Prometheus text format:
+	//
+	//	m := httpmux.NewMetrics(httpmux.MetricsConfig{Namespace: "asr"})
+	//	srv.Use(m.Middleware())
+	//	srv.GET("/metrics", m.Handle).Hide()
+	Metrics struct {
+		config   MetricsConfig
+		mu       sync.Mutex
+		requests map[requestLabels]*requestSeries
+		inFlight map[flightLabels]int64
+	}
+
+	requestLabels struct {
+		method, route, status, code string
+	}
+
+	flightLabels struct {
+		method, route string
+	}
+
+	requestSeries struct {
+		count   uint64
+		sum     float64
+		buckets []uint64
+	}
+)
+
+// DefaultMetricsBuckets are the default latency histogram buckets in seconds.
+var DefaultMetricsBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// NewMetrics returns a metrics collector with config.
+func NewMetrics(config MetricsConfig) *Metrics {
+	if config.Buckets == nil {
+		config.Buckets = DefaultMetricsBuckets
+	}
+	var buckets []float64
+	for _, le := range config.Buckets {
+		if !math.IsInf(le, 1) {
+			buckets = append(buckets, le)
+		}
+	}
+	sort.Float64s(buckets)
+	config.Buckets = buckets
+	return &Metrics{
+		config:   config,
+		requests: map[requestLabels]*requestSeries{},
+		inFlight: map[flightLabels]int64{},
+	}
+}
+
+// Middleware returns a middleware recording every request in m. Requests
+// which matched no route are labeled with an empty route, so that unknown
+// paths do not create new series.
+//
+// Like AccessLog, it returns errors of the next handle unchanged and records
+// the status StatusCode maps their code to. Panics are recorded with status
+// 500 and the code of aicode.ComInnerError.
+func (m *Metrics) Middleware() Middleware {
+	return func(next Handle) Handle {
+		return func(c Context) (err aicode.HTTPError) {
+			flight := flightLabels{method: c.Request().Method, route: c.Path()}
+			m.mu.Lock()
+			m.inFlight[flight]++
+			m.mu.Unlock()
+
+			start := time.Now()
+			defer func() {
+				rc := recover()
+				status, code := outcome(c, err)
+				if rc != nil {
+					status, code = http.StatusInternalServerError, aicode.ComInnerError.Code()
+				}
+				m.observe(requestLabels{
+					method: flight.method,
+					route:  flight.route,
+					status: strconv.Itoa(status),
+					code:   strconv.Itoa(code),
+				}, time.Since(start).Seconds())
+
+				m.mu.Lock()
+				m.inFlight[flight]--
+				m.mu.Unlock()
+				if rc != nil {
+					panic(rc)
+				}
+			}()
+			return next(c)
+		}
+	}
+}
+
+func (m *Metrics) observe(labels requestLabels, seconds float64) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s, ok := m.requests[labels]
+	if !ok {
+		s = &requestSeries{buckets: make([]uint64, len(m.config.Buckets))}
+		m.requests[labels] = s
+	}
+	s.count++
+	s.sum += seconds
+	for i, le := range m.config.Buckets {
+		if seconds <= le {
+			s.buckets[i]++
+		}
+	}
+}
+
+// Handle serves the metrics in the Prometheus text format.
+func (m *Metrics) Handle(c Context) aicode.HTTPError {
+	var buf bytes.Buffer
+	m.WriteTo(&buf)
+	c.Blob(http.StatusOK, MIMETextPrometheus, buf.Bytes())
+	return nil
+}
+
+// WriteTo writes the metrics to w in the Prometheus text format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	prefix := "http_"
+	if m.config.Namespace != "" {
+		prefix = m.config.Namespace + "_" + prefix
+	}
+
+	m.mu.Lock()
+	requests := make([]requestLabels, 0, len(m.requests))
+	for l := range m.requests {
+		requests = append(requests, l)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		if a.status != b.status {
+			return a.status < b.status
+		}
+		return a.code < b.code
+	})
+	series := make([]requestSeries, len(requests))
+	for i, l := range requests {
+		s := m.requests[l]
+		series[i] = requestSeries{count: s.count, sum: s.sum, buckets: append([]uint64(nil), s.buckets...)}
+	}
+	flights := make([]flightLabels, 0, len(m.inFlight))
+	gauges := map[flightLabels]int64{}
+	for l, n := range m.inFlight {
+		flights = append(flights, l)
+		gauges[l] = n
+	}
+	m.mu.Unlock()
+	sort.Slice(flights, func(i, j int) bool {
+		if flights[i].route != flights[j].route {
+			return flights[i].route < flights[j].route
+		}
+		return flights[i].method < flights[j].method
+	})
+
+	var buf bytes.Buffer
+	name := prefix + "requests_total"
+	fmt.Fprintf(&buf, "# HELP %s Total number of HTTP requests.\n# TYPE %s counter\n", name, name)
+	for i, l := range requests {
+		fmt.Fprintf(&buf, "%s{%s} %d\n", name, l.format(), series[i].count)
+	}
+
+	name = prefix + "request_duration_seconds"
+	fmt.Fprintf(&buf, "# HELP %s HTTP request latency in seconds.\n# TYPE %s histogram\n", name, name)
+	for i, l := range requests {
+		labels := l.format()
+		for j, le := range m.config.Buckets {
+			fmt.Fprintf(&buf, "%s_bucket{%s,le=%q} %d\n", name, labels, formatFloat(le), series[i].buckets[j])
+		}
+		fmt.Fprintf(&buf, "%s_bucket{%s,le=\"+Inf\"} %d\n", name, labels, series[i].count)
+		fmt.Fprintf(&buf, "%s_sum{%s} %s\n", name, labels, formatFloat(series[i].sum))
+		fmt.Fprintf(&buf, "%s_count{%s} %d\n", name, labels, series[i].count)
+	}
+
+	name = prefix + "requests_in_flight"
+	fmt.Fprintf(&buf, "# HELP %s Number of HTTP requests being served.\n# TYPE %s gauge\n", name, name)
+	for _, l := range flights {
+		fmt.Fprintf(&buf, "%s{method=\"%s\",route=\"%s\"} %d\n", name,
+			escapeLabel(l.method), escapeLabel(l.route), gauges[l])
+	}
+	return buf.WriteTo(w)
+}
+
+func (l requestLabels) format() string {
+	return fmt.Sprintf("method=\"%s\",route=\"%s\",status=\"%s\",code=\"%s\"",
+		escapeLabel(l.method), escapeLabel(l.route), l.status, l.code)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabel escapes a label value of the text format.
+func escapeLabel(v string) string {
+	return labelEscaper.Replace(v)
+}
+
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
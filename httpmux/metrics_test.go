@@ -0,0 +1,57 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func Test_Metrics(t *testing.T) {
+	m := NewMetrics(MetricsConfig{Namespace: "asr", Buckets: []float64{1, 0.1}})
+	srv := New()
+	srv.Use(m.Middleware())
+	srv.GET("/stream/:id", func(c Context) aicode.HTTPError {
+		if c.Param("id") == "busy" {
+			return aicode.ComLimit
+		}
+		c.String(200, "ok")
+		return nil
+	})
+	srv.GET("/panic", func(c Context) aicode.HTTPError {
+		panic("boom")
+	})
+	srv.GET("/metrics", m.Handle)
+
+	for _, path := range []string{"/stream/1", "/stream/2", "/stream/busy", "/missing\"path", "/panic"} {
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, path, nil))
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/metrics", nil))
+	if rec.Header().Get(HeaderContentType) != MIMETextPrometheus {
+		t.Errorf("content type %q", rec.Header().Get(HeaderContentType))
+	}
+	body := rec.Body.String()
+	for _, want := range []string{
+		"# TYPE asr_http_requests_total counter\n",
+		`asr_http_requests_total{method="GET",route="/stream/:id",status="200",code="0"} 2` + "\n",
+		`asr_http_requests_total{method="GET",route="/stream/:id",status="429",code="90007"} 1` + "\n",
+		`asr_http_requests_total{method="GET",route="",status="404",code="90002"} 1` + "\n",
+		`asr_http_requests_total{method="GET",route="/panic",status="500",code="` + strconv.Itoa(aicode.ComInnerError.Code()) + `"} 1` + "\n",
+		`asr_http_requests_in_flight{method="GET",route="/panic"} 0` + "\n",
+		"# TYPE asr_http_request_duration_seconds histogram\n",
+		`asr_http_request_duration_seconds_bucket{method="GET",route="/stream/:id",status="200",code="0",le="0.1"} 2` + "\n",
+		`asr_http_request_duration_seconds_bucket{method="GET",route="/stream/:id",status="200",code="0",le="+Inf"} 2` + "\n",
+		`asr_http_request_duration_seconds_count{method="GET",route="/stream/:id",status="200",code="0"} 2` + "\n",
+		`asr_http_requests_in_flight{method="GET",route="/metrics"} 1` + "\n",
+		`asr_http_requests_in_flight{method="GET",route="/stream/:id"} 0` + "\n",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics lack %q:\n%s", want, body)
+		}
+	}
+	if strings.Index(body, `le="0.1"`) > strings.Index(body, `le="1"`) {
+		t.Error("buckets not sorted")
+	}
+}
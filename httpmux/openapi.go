@@ -0,0 +1,472 @@
+package httpmux
+
+import (
+	"aicode"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+type (
+	// Route is a registered route. Its documentation methods describe it in
+	// the OpenAPI document and can be chained, e.g.
+	//
+	//	srv.POST("/stream/:id", handle).
+	//		Describe("Push audio", "").
+	//		Reads(StreamReq{}).Returns(StreamRsp{}).
+	//		Fails(aicode.ComBadParam, aicode.ComLimit)
+	Route struct {
+		Method      string
+		Path        string
+		Summary     string
+		Description string
+		Tags        []string
+		Request     reflect.Type
+		Response    reflect.Type
+		Errors      []aicode.HTTPError
+		Hidden      bool
+	}
+
+	// OpenAPIInfo is the info object of an OpenAPI document.
+	OpenAPIInfo struct {
+		Title       string
+		Version     string
+		Description string
+
+		// Servers are the base URLs of the API.
+		Servers []string
+	}
+
+	// schemaBuilder collects the component schemas of struct types.
+	schemaBuilder struct {
+		schemas map[string]interface{}
+		names   map[reflect.Type]string
+	}
+
+	object = map[string]interface{}
+)
+
+// Describe sets the summary and description of the route.
+func (rt *Route) Describe(summary, description string) *Route {
+	rt.Summary, rt.Description = summary, description
+	return rt
+}
+
+// Tag adds tags grouping the route in the document.
+func (rt *Route) Tag(tags ...string) *Route {
+	rt.Tags = append(rt.Tags, tags...)
+	return rt
+}
+
+// Reads sets the type bound by the handle, given as a value or pointer of
+// that type. Fields tagged `param`, `query` or `header` are documented as
+// parameters, the others as the JSON request body.
+func (rt *Route) Reads(v interface{}) *Route {
+	rt.Request = reflect.TypeOf(v)
+	return rt
+}
+
+// Returns sets the type of the JSON response body.
+func (rt *Route) Returns(v interface{}) *Route {
+	rt.Response = reflect.TypeOf(v)
+	return rt
+}
+
+// Fails adds the aicode errors the route may answer with.
+func (rt *Route) Fails(errs ...aicode.HTTPError) *Route {
+	rt.Errors = append(rt.Errors, errs...)
+	return rt
+}
+
+// Hide leaves the route out of the document.
+func (rt *Route) Hide() *Route {
+	rt.Hidden = true
+	return rt
+}
+
+// OpenAPI returns the OpenAPI 3 document of the routes registered so far.
+func (r *server) OpenAPI(info OpenAPIInfo) map[string]interface{} {
+	b := &schemaBuilder{schemas: object{}, names: map[reflect.Type]string{}}
+	b.schemas["Error"] = object{
+		"type":     "object",
+		"required": []string{"code", "msg"},
+		"properties": object{
+			"code": object{"type": "integer"},
+			"msg":  object{"type": "string"},
+		},
+	}
+
+	paths := object{}
+	for _, rt := range r.routes {
+		if rt.Hidden {
+			continue
+		}
+		path, params := openAPIPath(rt.Path)
+		item, ok := paths[path].(object)
+		if !ok {
+			item = object{}
+			paths[path] = item
+		}
+		item[strings.ToLower(rt.Method)] = b.operation(rt, params)
+	}
+
+	doc := object{
+		"openapi": "3.0.3",
+		"info": object{
+			"title":       info.Title,
+			"version":     info.Version,
+			"description": info.Description,
+		},
+		"paths":      paths,
+		"components": object{"schemas": b.schemas},
+	}
+	if len(info.Servers) > 0 {
+		servers := make([]object, len(info.Servers))
+		for i, url := range info.Servers {
+			servers[i] = object{"url": url}
+		}
+		doc["servers"] = servers
+	}
+	return doc
+}
+
+// OpenAPIJSON returns the OpenAPI document as indented JSON.
+func (r *server) OpenAPIJSON(info OpenAPIInfo) ([]byte, error) {
+	return json.MarshalIndent(r.OpenAPI(info), "", "  ")
+}
+
+// OpenAPIYAML returns the OpenAPI document as YAML.
+func (r *server) OpenAPIYAML(info OpenAPIInfo) ([]byte, error) {
+	return yaml.Marshal(r.OpenAPI(info))
+}
+
+// ServeOpenAPI registers a GET route at path serving the OpenAPI document,
+// as YAML when path ends with .yaml or .yml and as JSON otherwise. The
+// document is built on each request, so it includes routes registered later.
+func (r *server) ServeOpenAPI(path string, info OpenAPIInfo, middleware ...Middleware) *Route {
+	yml := strings.HasSuffix(path, ".yaml") || strings.HasSuffix(path, ".yml")
+	return r.GET(path, func(c Context) aicode.HTTPError {
+		if yml {
+			b, err := r.OpenAPIYAML(info)
+			if err != nil {
+				return aicode.ComInnerError
+			}
+			c.Blob(http.StatusOK, "application/yaml", b)
+			return nil
+		}
+		b, err := r.OpenAPIJSON(info)
+		if err != nil {
+			return aicode.ComInnerError
+		}
+		c.JSONBlob(http.StatusOK, b)
+		return nil
+	}, middleware...).Hide()
+}
+
+// openAPIPath converts an httprouter pattern such as "/stream/:id/*file" to
+// "/stream/{id}/{file}" and returns the parameter names.
+func openAPIPath(pattern string) (string, []string) {
+	segments := strings.Split(pattern, "/")
+	var params []string
+	for i, s := range segments {
+		if strings.HasPrefix(s, ":") || strings.HasPrefix(s, "*") {
+			params = append(params, s[1:])
+			segments[i] = "{" + s[1:] + "}"
+		}
+	}
+	return strings.Join(segments, "/"), params
+}
+
+func (b *schemaBuilder) operation(rt *Route, pathParams []string) object {
+	op := object{}
+	if rt.Summary != "" {
+		op["summary"] = rt.Summary
+	}
+	if rt.Description != "" {
+		op["description"] = rt.Description
+	}
+	if len(rt.Tags) > 0 {
+		op["tags"] = rt.Tags
+	}
+
+	var params []object
+	documented := map[string]bool{}
+	var body reflect.Type
+	if rt.Request != nil {
+		var bodyFields []reflect.StructField
+		t := derefType(rt.Request)
+		if t.Kind() == reflect.Struct {
+			for _, f := range exportedFields(t) {
+				in, name := "", ""
+				for _, tag := range []string{"param", "query", "header"} {
+					if v := f.Tag.Get(tag); v != "" && v != "-" {
+						in, name = tag, v
+						break
+					}
+				}
+				if in == "" {
+					bodyFields = append(bodyFields, f)
+					continue
+				}
+				if in == "param" {
+					in = "path"
+					documented[name] = true
+				}
+				p := object{"name": name, "in": in, "schema": b.schema(f.Type)}
+				if in == "path" || hasValidator(f, "required") {
+					p["required"] = true
+				}
+				params = append(params, p)
+			}
+			if len(bodyFields) > 0 && rt.Method != GET && rt.Method != HEAD && rt.Method != DELETE {
+				body = t
+			}
+		} else {
+			body = t
+		}
+	}
+	for _, name := range pathParams {
+		if !documented[name] {
+			params = append(params, object{"name": name, "in": "path", "required": true, "schema": object{"type": "string"}})
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+	if body != nil {
+		op["requestBody"] = object{
+			"required": true,
+			"content":  object{MIMEApplicationJSON: object{"schema": b.schema(body)}},
+		}
+	}
+
+	ok := object{"description": http.StatusText(http.StatusOK)}
+	if rt.Response != nil {
+		ok["content"] = object{MIMEApplicationJSON: object{"schema": b.schema(rt.Response)}}
+	}
+	responses := object{"200": ok}
+	byStatus := map[int][]string{}
+	for _, e := range rt.Errors {
+		status := StatusCode(e.Code())
+		byStatus[status] = append(byStatus[status], strconv.Itoa(e.Code())+" "+e.Msg())
+	}
+	for status, codes := range byStatus {
+		responses[strconv.Itoa(status)] = object{
+			"description": strings.Join(codes, "; "),
+			"content": object{MIMEApplicationJSON: object{
+				"schema": object{"$ref": "#/components/schemas/Error"},
+			}},
+		}
+	}
+	op["responses"] = responses
+	return op
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schema returns the schema of t. Named struct types are added to the
+// components and referenced.
+func (b *schemaBuilder) schema(t reflect.Type) object {
+	t = derefType(t)
+	if t == timeType {
+		return object{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return object{"type": "integer", "format": "int32"}
+	case reflect.Int64, reflect.Uint64:
+		return object{"type": "integer", "format": "int64"}
+	case reflect.Float32:
+		return object{"type": "number", "format": "float"}
+	case reflect.Float64:
+		return object{"type": "number", "format": "double"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return object{"type": "string", "format": "byte"}
+		}
+		return object{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name, ok := b.names[t]
+		if !ok {
+			name = b.componentName(t)
+			b.names[t] = name
+			b.schemas[name] = object{}
+			b.schemas[name] = b.structSchema(t)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	}
+	return object{}
+}
+
+// componentName names t by its type name, qualified by its package when the
+// name is taken already.
+func (b *schemaBuilder) componentName(t reflect.Type) string {
+	name := t.Name()
+	if _, taken := b.schemas[name]; taken {
+		pkg := t.PkgPath()
+		name = strings.Replace(pkg[strings.LastIndex(pkg, "/")+1:], ".", "_", -1) + "." + name
+	}
+	return name
+}
+
+// structSchema describes the JSON encoding of t, with the constraints of the
+// govalidator `valid` tags.
+func (b *schemaBuilder) structSchema(t reflect.Type) object {
+	props := object{}
+	var required []string
+	for _, f := range exportedFields(t) {
+		name := f.Name
+		if tag := f.Tag.Get("json"); tag != "" {
+			if tag == "-" {
+				continue
+			}
+			if n := strings.Split(tag, ",")[0]; n != "" {
+				name = n
+			}
+		}
+		if f.Tag.Get("param") != "" || f.Tag.Get("query") != "" || f.Tag.Get("header") != "" {
+			continue
+		}
+		s := object{}
+		for k, v := range b.schema(f.Type) {
+			s[k] = v
+		}
+		if applyValidators(f, s) {
+			required = append(required, name)
+		}
+		props[name] = s
+	}
+	schema := object{"type": "object", "properties": props}
+	if len(required) > 0 {
+		sort.Strings(required)
+		schema["required"] = required
+	}
+	return schema
+}
+
+// applyValidators translates the `valid` tag of f into schema constraints and
+// reports whether the field is required.
+func applyValidators(f reflect.StructField, s object) bool {
+	if _, isRef := s["$ref"]; isRef {
+		return hasValidator(f, "required")
+	}
+	required := false
+	isString := s["type"] == "string"
+	for _, v := range validators(f) {
+		name, args := v, []string(nil)
+		if i := strings.IndexByte(v, '('); i > 0 && strings.HasSuffix(v, ")") {
+			name, args = v[:i], strings.Split(v[i+1:len(v)-1], "|")
+		}
+		switch name {
+		case "required":
+			required = true
+		case "email":
+			s["format"] = "email"
+		case "url", "requrl", "requri":
+			s["format"] = "uri"
+		case "uuid", "uuidv3", "uuidv4", "uuidv5":
+			s["format"] = "uuid"
+		case "ipv4":
+			s["format"] = "ipv4"
+		case "ipv6":
+			s["format"] = "ipv6"
+		case "alpha":
+			s["pattern"] = "^[a-zA-Z]+$"
+		case "alphanum":
+			s["pattern"] = "^[a-zA-Z0-9]+$"
+		case "numeric":
+			s["pattern"] = "^[0-9]+$"
+		case "matches":
+			if len(args) == 1 {
+				s["pattern"] = args[0]
+			}
+		case "in":
+			s["enum"] = args
+		case "range":
+			if len(args) == 2 {
+				setNumber(s, "minimum", args[0])
+				setNumber(s, "maximum", args[1])
+			}
+		case "length", "runelength", "stringlength":
+			if len(args) == 2 && isString {
+				setNumber(s, "minLength", args[0])
+				setNumber(s, "maxLength", args[1])
+			}
+		}
+	}
+	return required
+}
+
+func setNumber(s object, key, v string) {
+	if n, err := strconv.ParseFloat(v, 64); err == nil {
+		s[key] = n
+	}
+}
+
+// validators returns the validators of the `valid` tag of f without their
+// custom error messages.
+func validators(f reflect.StructField) []string {
+	tag := f.Tag.Get("valid")
+	if tag == "" || tag == "-" {
+		return nil
+	}
+	var out []string
+	for _, v := range strings.Split(tag, ",") {
+		if i := strings.IndexByte(v, '~'); i >= 0 {
+			v = v[:i]
+		}
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+func hasValidator(f reflect.StructField, name string) bool {
+	for _, v := range validators(f) {
+		if v == name {
+			return true
+		}
+	}
+	return false
+}
+
+// exportedFields returns the exported fields of t, with the fields of
+// untagged embedded structs promoted.
+func exportedFields(t reflect.Type) []reflect.StructField {
+	var fields []reflect.StructField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if f.Anonymous && f.Tag.Get("json") == "" && derefType(f.Type).Kind() == reflect.Struct {
+			fields = append(fields, exportedFields(derefType(f.Type))...)
+			continue
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func derefType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	return t
+}
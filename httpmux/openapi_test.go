@@ -0,0 +1,130 @@
+package httpmux
+
+import (
+	"aicode"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v2"
+)
+
+type openAPIAudio struct {
+	Format string `json:"format" valid:"required,in(pcm|wav|opus)"`
+	Rate   int    `json:"rate" valid:"range(8000|48000)~bad rate"`
+}
+
+type openAPIReq struct {
+	ID     string       `param:"id"`
+	Lang   string       `query:"lang" valid:"required"`
+	Trace  string       `header:"X-Trace"`
+	Email  string       `json:"email" valid:"email,required"`
+	Name   string       `json:"name,omitempty" valid:"length(1|32)"`
+	Audio  openAPIAudio `json:"audio"`
+	Ignore string       `json:"-"`
+}
+
+type openAPIRsp struct {
+	Text  string   `json:"text"`
+	Words []string `json:"words"`
+}
+
+func Test_OpenAPI(t *testing.T) {
+	srv := New()
+	g := srv.Group("/v1")
+	g.POST("/stream/:id", func(c Context) aicode.HTTPError { return nil }).
+		Describe("Push audio", "").
+		Tag("stream").
+		Reads(&openAPIReq{}).
+		Returns(openAPIRsp{}).
+		Fails(aicode.ComBadParam, aicode.ComMissSid, aicode.ComLimit)
+	srv.GET("/files/*file", func(c Context) aicode.HTTPError { return nil })
+	srv.GET("/hidden", func(c Context) aicode.HTTPError { return nil }).Hide()
+	srv.ServeOpenAPI("/openapi.json", OpenAPIInfo{Title: "asr", Version: "1.0"})
+	srv.ServeOpenAPI("/openapi.yaml", OpenAPIInfo{Title: "asr", Version: "1.0"})
+
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	rsp, err := http.Get(ts.URL + "/openapi.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.NewDecoder(rsp.Body).Decode(&doc); err != nil {
+		t.Fatal(err)
+	}
+	rsp.Body.Close()
+
+	paths := doc["paths"].(map[string]interface{})
+	if len(paths) != 2 {
+		t.Fatalf("paths %v", paths)
+	}
+	if _, ok := paths["/files/{file}"]; !ok {
+		t.Errorf("catch-all path missing: %v", paths)
+	}
+	op := paths["/v1/stream/{id}"].(map[string]interface{})["post"].(map[string]interface{})
+	if op["summary"] != "Push audio" {
+		t.Errorf("summary %v", op["summary"])
+	}
+
+	var params []string
+	for _, p := range op["parameters"].([]interface{}) {
+		p := p.(map[string]interface{})
+		param := p["in"].(string) + ":" + p["name"].(string)
+		if p["required"] == true {
+			param += "*"
+		}
+		params = append(params, param)
+	}
+	if want := []string{"path:id*", "query:lang*", "header:X-Trace"}; !reflect.DeepEqual(params, want) {
+		t.Errorf("parameters %v, want %v", params, want)
+	}
+
+	responses := op["responses"].(map[string]interface{})
+	d := responses["400"].(map[string]interface{})["description"].(string)
+	if !strings.Contains(d, aicode.ComBadParam.Msg()) || !strings.Contains(d, aicode.ComMissSid.Msg()) {
+		t.Errorf("400 description %q", d)
+	}
+	if _, ok := responses["429"]; !ok {
+		t.Errorf("responses %v", responses)
+	}
+
+	schemas := doc["components"].(map[string]interface{})["schemas"].(map[string]interface{})
+	req := schemas["openAPIReq"].(map[string]interface{})
+	props := req["properties"].(map[string]interface{})
+	if len(props) != 3 {
+		t.Errorf("request properties %v", props)
+	}
+	if !reflect.DeepEqual(req["required"], []interface{}{"email"}) {
+		t.Errorf("required %v", req["required"])
+	}
+	if props["email"].(map[string]interface{})["format"] != "email" {
+		t.Errorf("email %v", props["email"])
+	}
+	if n := props["name"].(map[string]interface{}); n["minLength"] != 1.0 || n["maxLength"] != 32.0 {
+		t.Errorf("name %v", n)
+	}
+	audio := schemas["openAPIAudio"].(map[string]interface{})["properties"].(map[string]interface{})
+	if r := audio["rate"].(map[string]interface{}); r["minimum"] != 8000.0 || r["maximum"] != 48000.0 {
+		t.Errorf("rate %v", r)
+	}
+	if e := audio["format"].(map[string]interface{})["enum"]; !reflect.DeepEqual(e, []interface{}{"pcm", "wav", "opus"}) {
+		t.Errorf("enum %v", e)
+	}
+
+	rsp, err = http.Get(ts.URL + "/openapi.yaml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rsp.Body.Close()
+	var ydoc map[string]interface{}
+	if err := yaml.NewDecoder(rsp.Body).Decode(&ydoc); err != nil {
+		t.Fatal(err)
+	}
+	if ydoc["openapi"] != "3.0.3" {
+		t.Errorf("yaml document %v", ydoc)
+	}
+}
@@ -0,0 +1,216 @@
+package httpmux
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// forwardedHop is one proxy hop of the Forwarded or X-Forwarded-For header:
+// the address the proxy received the request from and the protocol it was
+// received with.
+type forwardedHop struct {
+	addr  string
+	proto string
+}
+
+// SetTrustedProxies sets TrustedProxies from CIDRs such as "10.0.0.0/8" or
+// single addresses such as "127.0.0.1".
+func (r *server) SetTrustedProxies(proxies ...string) error {
+	nets := make([]*net.IPNet, 0, len(proxies))
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return fmt.Errorf("httpmux: invalid trusted proxy %q", p)
+			}
+			bits := 128
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 32
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(p)
+		if err != nil {
+			return fmt.Errorf("httpmux: invalid trusted proxy %q: %v", p, err)
+		}
+		nets = append(nets, n)
+	}
+	r.TrustedProxies = nets
+	return nil
+}
+
+func (r *server) isTrustedProxy(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range r.TrustedProxies {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// forwarded returns the client address and the protocol it connected with,
+// or "" when unknown. The hops of the Forwarded header, or X-Forwarded-For
+// when it is absent, are walked from the nearest proxy back to the client and
+// the walk stops at the first address which is not a trusted proxy: entries
+// left of it could have been written by anyone.
+func (c *context) forwarded() (string, string) {
+	ip := hopAddr(c.request.RemoteAddr)
+	if !c.mux.isTrustedProxy(net.ParseIP(ip)) {
+		return ip, ""
+	}
+
+	h := c.request.Header
+	hops := forwardedHeaderHops(h[HeaderForwarded])
+	if len(hops) == 0 {
+		hops = xForwardedHops(h)
+	}
+	if len(hops) == 0 {
+		if real := hopAddr(h.Get(HeaderXRealIP)); net.ParseIP(real) != nil {
+			ip = real
+		}
+		return ip, xForwardedProto(h)
+	}
+
+	proto := ""
+	for i := len(hops) - 1; i >= 0; i-- {
+		hip := net.ParseIP(hops[i].addr)
+		if hip == nil {
+			// Obfuscated or unknown: the proxy which wrote it is the
+			// furthest address known.
+			break
+		}
+		ip, proto = hops[i].addr, hops[i].proto
+		if !c.mux.isTrustedProxy(hip) {
+			break
+		}
+	}
+	return ip, proto
+}
+
+// forwardedHeaderHops parses RFC 7239 Forwarded header values such as
+// `for=192.0.2.60;proto=https, for="[2001:db8::1]:4711"`.
+func forwardedHeaderHops(values []string) []forwardedHop {
+	var hops []forwardedHop
+	for _, v := range values {
+		for _, elem := range splitQuoted(v, ',') {
+			var hop forwardedHop
+			for _, pair := range splitQuoted(elem, ';') {
+				i := strings.IndexByte(pair, '=')
+				if i < 0 {
+					continue
+				}
+				key := strings.ToLower(strings.TrimSpace(pair[:i]))
+				val := unquote(strings.TrimSpace(pair[i+1:]))
+				switch key {
+				case "for":
+					hop.addr = hopAddr(val)
+				case "proto":
+					hop.proto = normalizeProto(val)
+				}
+			}
+			if hop.addr != "" {
+				hops = append(hops, hop)
+			}
+		}
+	}
+	return hops
+}
+
+// xForwardedHops parses X-Forwarded-For. X-Forwarded-Proto entries are
+// matched to the hops when both headers list as many entries, otherwise the
+// last one applies to every hop.
+func xForwardedHops(h map[string][]string) []forwardedHop {
+	var addrs, protos []string
+	for _, v := range h[HeaderXForwardedFor] {
+		addrs = append(addrs, strings.Split(v, ",")...)
+	}
+	for _, v := range h[HeaderXForwardedProto] {
+		protos = append(protos, strings.Split(v, ",")...)
+	}
+	var hops []forwardedHop
+	for i, a := range addrs {
+		hop := forwardedHop{addr: hopAddr(a)}
+		if len(protos) == len(addrs) {
+			hop.proto = normalizeProto(protos[i])
+		} else if len(protos) > 0 {
+			hop.proto = normalizeProto(protos[len(protos)-1])
+		}
+		if hop.proto == "" {
+			hop.proto = xForwardedProto(h)
+		}
+		if hop.addr != "" {
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
+
+// xForwardedProto returns the protocol of the non-standard headers.
+func xForwardedProto(h map[string][]string) string {
+	get := func(key string) string {
+		if v := h[key]; len(v) > 0 {
+			list := strings.Split(v[len(v)-1], ",")
+			return strings.TrimSpace(list[len(list)-1])
+		}
+		return ""
+	}
+	if proto := normalizeProto(get(HeaderXForwardedProto)); proto != "" {
+		return proto
+	}
+	if proto := normalizeProto(get(HeaderXForwardedProtocol)); proto != "" {
+		return proto
+	}
+	if get(HeaderXForwardedSsl) == "on" {
+		return "https"
+	}
+	return normalizeProto(get(HeaderXUrlScheme))
+}
+
+func normalizeProto(proto string) string {
+	switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+	case "http", "https":
+		return proto
+	}
+	return ""
+}
+
+// hopAddr strips the quotes, brackets and port of an address.
+func hopAddr(s string) string {
+	s = unquote(strings.TrimSpace(s))
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 && s[0] == '"' && s[len(s)-1] == '"' {
+		s = strings.Replace(s[1:len(s)-1], `\`, "", -1)
+	}
+	return s
+}
+
+// splitQuoted splits s at sep outside of quoted strings.
+func splitQuoted(s string, sep byte) []string {
+	var parts []string
+	quoted, start := false, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			quoted = !quoted
+		case sep:
+			if !quoted {
+				parts = append(parts, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(parts, s[start:])
+}
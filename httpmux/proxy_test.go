@@ -0,0 +1,47 @@
+package httpmux
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_TrustedProxies(t *testing.T) {
+	srv := New()
+	if err := srv.SetTrustedProxies("10.0.0.0/8", "2001:db8::1", "bad"); err == nil {
+		t.Error("invalid proxy accepted")
+	}
+	if err := srv.SetTrustedProxies("10.0.0.0/8", "2001:db8::1"); err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		remote string
+		header map[string]string
+		ip     string
+		scheme string
+	}{
+		// untrusted peers cannot spoof
+		{"192.0.2.1:1234", map[string]string{HeaderXForwardedFor: "1.1.1.1", HeaderXForwardedProto: "https"}, "192.0.2.1", "http"},
+		{"192.0.2.1:1234", map[string]string{HeaderXRealIP: "1.1.1.1"}, "192.0.2.1", "http"},
+		// XFF is walked right to left through trusted hops only
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "6.6.6.6, 198.51.100.7, 10.1.1.1"}, "198.51.100.7", "http"},
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "10.2.2.2, 10.1.1.1"}, "10.2.2.2", "http"},
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedFor: "198.51.100.7", HeaderXForwardedProto: "HTTPS"}, "198.51.100.7", "https"},
+		{"10.0.0.1:1234", map[string]string{HeaderXRealIP: "198.51.100.7", HeaderXForwardedSsl: "on"}, "198.51.100.7", "https"},
+		{"10.0.0.1:1234", map[string]string{HeaderXForwardedProto: "gopher"}, "10.0.0.1", "http"},
+		// RFC 7239
+		{"[2001:db8::1]:443", map[string]string{HeaderForwarded: `for=6.6.6.6;proto=http, for="[2001:db8::cafe]:4711";proto=https`}, "2001:db8::cafe", "https"},
+		{"10.0.0.1:1234", map[string]string{HeaderForwarded: `for=198.51.100.7;proto=https, for=_hidden`, HeaderXForwardedFor: "6.6.6.6"}, "10.0.0.1", "http"},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(GET, "/", nil)
+		req.RemoteAddr = tc.remote
+		for k, v := range tc.header {
+			req.Header.Set(k, v)
+		}
+		c := srv.NewContext(req, httptest.NewRecorder())
+		if ip, scheme := c.RealIP(), c.Scheme(); ip != tc.ip || scheme != tc.scheme {
+			t.Errorf("%s %v: got %s %s, want %s %s", tc.remote, tc.header, ip, scheme, tc.ip, tc.scheme)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package httpmux
+
+import (
+	"aicode"
+	"fmt"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type (
+	// RateAlgorithm selects how requests are counted by RateLimit.
+	RateAlgorithm int
+
+	// Rate allows Limit requests per Window.
+	Rate struct {
+		Limit  int
+		Window time.Duration
+
+		// Burst is the token bucket capacity. Default is Limit.
+		Burst int
+
+		// Algorithm is TokenBucket or SlidingWindow. Default is TokenBucket.
+		Algorithm RateAlgorithm
+	}
+
+	// RateResult is the outcome of RateLimitStore.Take.
+	RateResult struct {
+		Allowed    bool
+		Remaining  int
+		Reset      time.Duration
+		RetryAfter time.Duration
+	}
+
+	// RateLimitStore keeps the rate limit state of every key.
+	RateLimitStore interface {
+		// Take counts one request of key against rate.
+		Take(key string, rate Rate, now time.Time) RateResult
+	}
+
+	// RateLimitConfig defines the config for RateLimit middleware.
+	RateLimitConfig struct {
+		// Rate is applied to every route without an override.
+		Rate
+
+		// Overrides maps route patterns, as returned by Context.Path, to the
+		// rate applied instead of Rate.
+		Overrides map[string]Rate
+
+		// KeyFunc returns the key requests are counted by.
+		// Default is RateLimitByIP.
+		KeyFunc func(c Context) string
+
+		// Store keeps the counters. Default is a MemoryRateStore evicting keys
+		// idle for 10 minutes.
+		Store RateLimitStore
+	}
+
+	// MemoryRateStore is an in-memory RateLimitStore. Keys which were not used
+	// for the idle duration are evicted.
+	MemoryRateStore struct {
+		idle      time.Duration
+		mu        sync.Mutex
+		limiters  map[string]*limiter
+		lastSweep time.Time
+	}
+
+	limiter struct {
+		lastSeen time.Time
+
+		// token bucket
+		tokens float64
+		last   time.Time
+
+		// sliding window
+		start     time.Time
+		prevCount int
+		currCount int
+	}
+)
+
+const (
+	// TokenBucket refills Limit tokens per Window, up to Burst tokens.
+	TokenBucket RateAlgorithm = iota
+
+	// SlidingWindow weights the count of the previous window by its overlap
+	// with the sliding window ending now.
+	SlidingWindow
+)
+
+// RateLimit returns a middleware allowing limit requests per window for each
+// client IP, with the token bucket algorithm.
+func RateLimit(limit int, window time.Duration) Middleware {
+	return RateLimitWithConfig(RateLimitConfig{Rate: Rate{Limit: limit, Window: window}})
+}
+
+// RateLimitWithConfig returns a RateLimit middleware with config.
+//
+// Responses carry X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers. Rejected requests get a Retry-After header and
+// aicode.ComLimit.
+func RateLimitWithConfig(config RateLimitConfig) Middleware {
+	if config.KeyFunc == nil {
+		config.KeyFunc = RateLimitByIP
+	}
+	if config.Store == nil {
+		config.Store = NewMemoryRateStore(10 * time.Minute)
+	}
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			rate, key := config.Rate, config.KeyFunc(c)
+			if r, ok := config.Overrides[c.Path()]; ok {
+				rate, key = r, key+"|"+c.Path()
+			}
+			if rate.Limit <= 0 || rate.Window <= 0 {
+				return next(c)
+			}
+			res := config.Store.Take(key, rate, time.Now())
+			h := c.Response().Header()
+			h.Set(HeaderXRateLimitLimit, strconv.Itoa(rate.Limit))
+			h.Set(HeaderXRateLimitRemaining, strconv.Itoa(res.Remaining))
+			h.Set(HeaderXRateLimitReset, strconv.Itoa(ceilSeconds(res.Reset)))
+			if !res.Allowed {
+				h.Set(HeaderRetryAfter, strconv.Itoa(ceilSeconds(res.RetryAfter)))
+				return aicode.ComLimit
+			}
+			return next(c)
+		}
+	}
+}
+
+// RateLimitByIP counts requests by Context.RealIP.
+func RateLimitByIP(c Context) string {
+	return c.RealIP()
+}
+
+// RateLimitByRoute counts requests by method and route pattern, shared by all
+// clients.
+func RateLimitByRoute(c Context) string {
+	return c.Request().Method + " " + c.Path()
+}
+
+// RateLimitByContext counts requests by the Context value stored under key,
+// e.g. the user set by an authentication middleware. Requests without the
+// value are counted by IP.
+func RateLimitByContext(key string) func(c Context) string {
+	return func(c Context) string {
+		if v := c.Get(key); v != nil {
+			return fmt.Sprint("ctx:", v)
+		}
+		return "ip:" + c.RealIP()
+	}
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
+
+// NewMemoryRateStore creates a MemoryRateStore evicting keys idle for idle.
+func NewMemoryRateStore(idle time.Duration) *MemoryRateStore {
+	return &MemoryRateStore{idle: idle, limiters: make(map[string]*limiter)}
+}
+
+// Take implements the RateLimitStore interface.
+func (s *MemoryRateStore) Take(key string, rate Rate, now time.Time) RateResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if now.Sub(s.lastSweep) >= s.idle {
+		for k, l := range s.limiters {
+			if now.Sub(l.lastSeen) >= s.idle {
+				delete(s.limiters, k)
+			}
+		}
+		s.lastSweep = now
+	}
+	l, ok := s.limiters[key]
+	if !ok {
+		l = &limiter{tokens: -1}
+		s.limiters[key] = l
+	}
+	l.lastSeen = now
+	if rate.Algorithm == SlidingWindow {
+		return l.slidingWindow(rate, now)
+	}
+	return l.tokenBucket(rate, now)
+}
+
+// Len returns the number of keys in the store.
+func (s *MemoryRateStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.limiters)
+}
+
+func (l *limiter) tokenBucket(rate Rate, now time.Time) RateResult {
+	burst := float64(rate.Burst)
+	if burst <= 0 {
+		burst = float64(rate.Limit)
+	}
+	perSecond := float64(rate.Limit) / rate.Window.Seconds()
+	if l.tokens < 0 {
+		l.tokens = burst
+	} else {
+		l.tokens = math.Min(burst, l.tokens+now.Sub(l.last).Seconds()*perSecond)
+	}
+	l.last = now
+
+	res := RateResult{}
+	if l.tokens >= 1 {
+		l.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - l.tokens) / perSecond * float64(time.Second))
+	}
+	res.Remaining = int(l.tokens)
+	res.Reset = time.Duration((burst - l.tokens) / perSecond * float64(time.Second))
+	return res
+}
+
+func (l *limiter) slidingWindow(rate Rate, now time.Time) RateResult {
+	start := now.Truncate(rate.Window)
+	if !start.Equal(l.start) {
+		if start.Sub(l.start) == rate.Window {
+			l.prevCount = l.currCount
+		} else {
+			l.prevCount = 0
+		}
+		l.currCount = 0
+		l.start = start
+	}
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(rate.Window)
+	estimate := float64(l.prevCount)*weight + float64(l.currCount)
+
+	res := RateResult{Reset: rate.Window - elapsed}
+	if estimate+1 <= float64(rate.Limit) {
+		l.currCount++
+		estimate++
+		res.Allowed = true
+	} else if l.currCount+1 > rate.Limit || l.prevCount == 0 {
+		res.RetryAfter = rate.Window - elapsed
+	} else {
+		// wait until enough of the previous window slid out
+		excess := estimate + 1 - float64(rate.Limit)
+		res.RetryAfter = time.Duration(excess / float64(l.prevCount) * float64(rate.Window))
+	}
+	res.Remaining = rate.Limit - int(math.Ceil(estimate))
+	if res.Remaining < 0 {
+		res.Remaining = 0
+	}
+	return res
+}
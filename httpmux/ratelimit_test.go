@@ -0,0 +1,66 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_RateLimitStore(t *testing.T) {
+	now := time.Unix(1000, 0)
+	for _, algorithm := range []RateAlgorithm{TokenBucket, SlidingWindow} {
+		s := NewMemoryRateStore(time.Minute)
+		rate := Rate{Limit: 2, Window: time.Second, Algorithm: algorithm}
+		var allowed int
+		for i := 0; i < 3; i++ {
+			if s.Take("k", rate, now).Allowed {
+				allowed++
+			}
+		}
+		if allowed != 2 {
+			t.Errorf("algorithm %d: allowed %d of 3", algorithm, allowed)
+		}
+		if res := s.Take("k", rate, now.Add(2*time.Second)); !res.Allowed {
+			t.Errorf("algorithm %d: not allowed after window", algorithm)
+		}
+		s.Take("other", rate, now.Add(2*time.Minute))
+		if s.Len() != 1 {
+			t.Errorf("algorithm %d: idle key not evicted, %d keys", algorithm, s.Len())
+		}
+	}
+}
+
+func Test_RateLimit(t *testing.T) {
+	srv := New()
+	srv.Use(RateLimitWithConfig(RateLimitConfig{
+		Rate:      Rate{Limit: 1, Window: time.Minute},
+		Overrides: map[string]Rate{"/bulk": {Limit: 3, Window: time.Minute}},
+	}))
+	ok := func(c Context) aicode.HTTPError {
+		c.NoContent(http.StatusOK)
+		return nil
+	}
+	srv.GET("/one", ok)
+	srv.GET("/bulk", ok)
+
+	codes := func(target string, n int) []int {
+		var out []int
+		for i := 0; i < n; i++ {
+			rec := httptest.NewRecorder()
+			srv.ServeHTTP(rec, httptest.NewRequest(GET, target, nil))
+			out = append(out, rec.Code)
+			if rec.Code == http.StatusTooManyRequests && rec.Header().Get(HeaderRetryAfter) == "" {
+				t.Errorf("%s: missing Retry-After", target)
+			}
+		}
+		return out
+	}
+	if got := codes("/one", 2); got[0] != 200 || got[1] != 429 {
+		t.Errorf("/one codes %v", got)
+	}
+	if got := codes("/bulk", 4); got[2] != 200 || got[3] != 429 {
+		t.Errorf("/bulk codes %v", got)
+	}
+}
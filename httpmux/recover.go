@@ -0,0 +1,66 @@
+package httpmux
+
+import (
+	"aicode"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/debug"
+	"time"
+)
+
+type (
+	// PanicReporter is called with every panic recovered while serving a
+	// request, after it was logged.
+	PanicReporter func(c Context, rc interface{}, stack []byte)
+
+	// panicError carries a panic, and the stack where it happened, from the
+	// goroutine of a handle to the goroutine serving the request.
+	panicError struct {
+		value interface{}
+		stack []byte
+	}
+)
+
+// recoverPanic handles a panic raised while serving c: it logs the panic with
+// its stack, calls the PanicReporter and answers with aicode.ComInnerError,
+// so that no detail of the panic reaches the client.
+//
+// http.ErrAbortHandler is panicked again, to let net/http abort the response
+// silently.
+func (r *server) recoverPanic(c Context, rc interface{}) {
+	stack := []byte(nil)
+	if pe, ok := rc.(*panicError); ok {
+		rc, stack = pe.value, pe.stack
+	}
+	if rc == http.ErrAbortHandler {
+		panic(rc)
+	}
+	if stack == nil {
+		stack = debug.Stack()
+	}
+	req := c.Request()
+	r.Logger.Errorf("panic recovered id=%s method=%s path=%q: %v\n%s", RequestIDFrom(c), req.Method, req.URL.Path, rc, stack)
+	if r.PanicReporter != nil {
+		r.PanicReporter(c, rc, stack)
+	}
+	c.Error(aicode.ComInnerError)
+}
+
+// CrashDumpReporter returns a PanicReporter which writes every panic with its
+// request and stack to a new file in dir.
+func CrashDumpReporter(dir string) PanicReporter {
+	return func(c Context, rc interface{}, stack []byte) {
+		now := time.Now()
+		name := fmt.Sprintf("crash-%s-%09d.log", now.Format("20060102-150405"), now.Nanosecond())
+		f, err := os.Create(filepath.Join(dir, name))
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		req := c.Request()
+		fmt.Fprintf(f, "time: %s\nrequest id: %s\nrequest: %s %s\nroute: %s\nremote: %s\npanic: %v\n\n%s",
+			now.Format(time.RFC3339Nano), RequestIDFrom(c), req.Method, req.URL, c.Path(), c.RealIP(), rc, stack)
+	}
+}
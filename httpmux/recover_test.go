@@ -0,0 +1,77 @@
+package httpmux
+
+import (
+	"aicode"
+	"bytes"
+	"io/ioutil"
+	"logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func panicHandle(c Context) aicode.HTTPError {
+	var m map[string]int
+	m["boom"] = 1
+	return nil
+}
+
+func Test_RecoverPanic(t *testing.T) {
+	buf := new(bytes.Buffer)
+	var reported []byte
+	srv := New()
+	srv.Logger = logger.NewLogger(buf)
+	srv.PanicReporter = func(c Context, rc interface{}, stack []byte) {
+		reported = stack
+	}
+	srv.Use(RequestID())
+	srv.GET("/panic", panicHandle)
+	srv.GET("/timeout", panicHandle, Timeout(time.Second))
+	srv.GET("/abort", func(c Context) aicode.HTTPError {
+		panic(http.ErrAbortHandler)
+	})
+
+	for _, target := range []string{"/panic", "/timeout"} {
+		buf.Reset()
+		reported = nil
+		req := httptest.NewRequest(GET, target, nil)
+		req.Header.Set(HeaderXRequestID, "crash-1")
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != http.StatusInternalServerError || strings.Contains(rec.Body.String(), "nil map") {
+			t.Errorf("%s: status %d body %q", target, rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(buf.String(), "id=crash-1") || !strings.Contains(string(reported), "panicHandle") {
+			t.Errorf("%s: log %q, reported stack %q", target, buf.String(), reported)
+		}
+	}
+
+	func() {
+		defer func() {
+			if rc := recover(); rc != http.ErrAbortHandler {
+				t.Errorf("abort recovered %v", rc)
+			}
+		}()
+		srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/abort", nil))
+	}()
+}
+
+func Test_CrashDumpReporter(t *testing.T) {
+	dir := t.TempDir()
+	srv := New()
+	srv.Logger = logger.NewLogger(ioutil.Discard)
+	srv.PanicReporter = CrashDumpReporter(dir)
+	srv.GET("/panic", panicHandle)
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/panic", nil))
+
+	files, _ := ioutil.ReadDir(dir)
+	if len(files) != 1 {
+		t.Fatalf("%d crash dumps", len(files))
+	}
+	b, _ := ioutil.ReadFile(dir + "/" + files[0].Name())
+	if !strings.Contains(string(b), "GET /panic") || !strings.Contains(string(b), "panicHandle") {
+		t.Errorf("crash dump %q", b)
+	}
+}
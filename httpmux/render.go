@@ -0,0 +1,236 @@
+package httpmux
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type (
+	// Renderer is the interface that wraps the Render function. It is used by
+	// Context.Render.
+	Renderer interface {
+		Render(w io.Writer, name string, data interface{}, c Context) error
+	}
+
+	// TemplateRenderer is a Renderer based on html/template. Every page is
+	// parsed together with the layout templates, so pages can fill the blocks
+	// declared by a layout.
+	TemplateRenderer struct {
+		// FS holds the template files, e.g. os.DirFS("views") or an embed.FS.
+		FS fs.FS
+
+		// Layouts are glob patterns of the layout and partial templates shared by
+		// every page, e.g. "layouts/*.html".
+		Layouts []string
+
+		// Pages are glob patterns of the page templates. A page is rendered by its
+		// path in FS, e.g. "admin/index.html".
+		Pages []string
+
+		// Layout is the template executed to render a page, e.g. "base" for a
+		// layout declared with {{define "base"}}. When empty the page itself is
+		// executed.
+		Layout string
+
+		// Funcs is added to every template before parsing. The request
+		// functions, such as cspNonce, are always available.
+		Funcs template.FuncMap
+
+		// DevMode reloads the templates on Render when a file was added, removed
+		// or modified since they were parsed.
+		DevMode bool
+
+		mu        sync.RWMutex
+		pages     map[string]*page
+		signature string
+	}
+
+	// page is a parsed page template. It is never executed itself, since
+	// html/template cannot clone a template after its execution: renders
+	// execute clones of it, which are kept for later renders.
+	page struct {
+		t     *template.Template
+		bound sync.Pool
+	}
+
+	// boundPage is a clone of a page whose request functions read c, the
+	// Context of the render using it.
+	boundPage struct {
+		t *template.Template
+		c Context
+	}
+)
+
+// contextFuncs are the template functions whose value depends on the request.
+// TemplateRenderer binds them to the Context of every Render.
+var contextFuncs = map[string]func(c Context) string{
+	"cspNonce":  CSPNonce,
+	"csrfToken": CSRFToken,
+}
+
+// NewTemplateRenderer creates a TemplateRenderer for the pages in fsys and
+// parses them.
+func NewTemplateRenderer(fsys fs.FS, layouts []string, pages ...string) (*TemplateRenderer, error) {
+	r := &TemplateRenderer{FS: fsys, Layouts: layouts, Pages: pages}
+	return r, r.Load()
+}
+
+// Load parses all templates, replacing the ones parsed before.
+func (r *TemplateRenderer) Load() error {
+	layouts, err := r.glob(r.Layouts)
+	if err != nil {
+		return err
+	}
+	pages, err := r.glob(r.Pages)
+	if err != nil {
+		return err
+	}
+	signature, err := r.sign(append(layouts, pages...))
+	if err != nil {
+		return err
+	}
+
+	set := make(map[string]*page, len(pages))
+	for _, path := range pages {
+		t := template.New("").Funcs(unboundFuncs()).Funcs(r.Funcs)
+		for _, name := range append(layouts, path) {
+			b, err := fs.ReadFile(r.FS, name)
+			if err != nil {
+				return err
+			}
+			if _, err = t.New(name).Parse(string(b)); err != nil {
+				return err
+			}
+		}
+		set[path] = &page{t: t}
+	}
+
+	r.mu.Lock()
+	r.pages = set
+	r.signature = signature
+	r.mu.Unlock()
+	return nil
+}
+
+// Render implements the Renderer interface.
+func (r *TemplateRenderer) Render(w io.Writer, name string, data interface{}, c Context) error {
+	if err := r.reload(); err != nil {
+		return err
+	}
+	r.mu.RLock()
+	p, ok := r.pages[name]
+	r.mu.RUnlock()
+	if !ok {
+		return fmt.Errorf("template %q not found", name)
+	}
+	b, err := p.get()
+	if err != nil {
+		return err
+	}
+	b.c = c
+	defer func() {
+		b.c = nil
+		p.bound.Put(b)
+	}()
+	if r.Layout != "" {
+		return b.t.ExecuteTemplate(w, r.Layout, data)
+	}
+	return b.t.ExecuteTemplate(w, name, data)
+}
+
+// unboundFuncs declares the request functions at parse time.
+func unboundFuncs() template.FuncMap {
+	funcs := template.FuncMap{}
+	for name := range contextFuncs {
+		funcs[name] = func() string { return "" }
+	}
+	return funcs
+}
+
+// get returns a clone of the page which no other render is using. Clones are
+// only made when none is free, so the templates are escaped once per clone
+// rather than on every render.
+func (p *page) get() (*boundPage, error) {
+	if b, ok := p.bound.Get().(*boundPage); ok {
+		return b, nil
+	}
+	t, err := p.t.Clone()
+	if err != nil {
+		return nil, err
+	}
+	b := &boundPage{}
+	funcs := template.FuncMap{}
+	for name, fn := range contextFuncs {
+		fn := fn
+		funcs[name] = func() string {
+			if b.c == nil {
+				return ""
+			}
+			return fn(b.c)
+		}
+	}
+	b.t = t.Funcs(funcs)
+	return b, nil
+}
+
+// reload loads the templates on first use, and in dev mode whenever the files
+// changed.
+func (r *TemplateRenderer) reload() error {
+	r.mu.RLock()
+	loaded, signature := r.pages != nil, r.signature
+	r.mu.RUnlock()
+	if !loaded {
+		return r.Load()
+	}
+	if !r.DevMode {
+		return nil
+	}
+	files, err := r.glob(append(r.Layouts[:len(r.Layouts):len(r.Layouts)], r.Pages...))
+	if err != nil {
+		return err
+	}
+	current, err := r.sign(files)
+	if err != nil {
+		return err
+	}
+	if current != signature {
+		return r.Load()
+	}
+	return nil
+}
+
+func (r *TemplateRenderer) glob(patterns []string) ([]string, error) {
+	var files []string
+	for _, pattern := range patterns {
+		matches, err := fs.Glob(r.FS, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("pattern %q matches no templates", pattern)
+		}
+		files = append(files, matches...)
+	}
+	return files, nil
+}
+
+// sign describes the names and modification times of files, so that any
+// change in the set can be detected by comparing signatures.
+func (r *TemplateRenderer) sign(files []string) (string, error) {
+	names := append([]string(nil), files...)
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fi, err := fs.Stat(r.FS, name)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "%s:%d:%d;", name, fi.Size(), fi.ModTime().UnixNano())
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,80 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func Test_TemplateRenderer(t *testing.T) {
+	fsys := fstest.MapFS{
+		"layouts/base.html": {Data: []byte(`{{define "base"}}<h1>{{template "title" .}}</h1>{{template "body" .}}{{end}}`)},
+		"admin/index.html":  {Data: []byte(`{{define "title"}}admin{{end}}{{define "body"}}hello {{.}}{{end}}`)},
+	}
+	r, err := NewTemplateRenderer(fsys, []string{"layouts/*.html"}, "admin/*.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.Layout = "base"
+	r.DevMode = true
+
+	srv := New()
+	srv.Renderer = r
+	srv.GET("/", func(c Context) aicode.HTTPError {
+		if err := c.Render(http.StatusOK, "admin/index.html", "ai"); err != nil {
+			t.Error(err)
+		}
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/", nil))
+	if got, want := rec.Body.String(), "<h1>admin</h1>hello ai"; got != want {
+		t.Errorf("body %q, want %q", got, want)
+	}
+
+	fsys["admin/index.html"] = &fstest.MapFile{Data: []byte(`{{define "title"}}admin{{end}}{{define "body"}}bye {{.}}{{end}}`), ModTime: time.Now()}
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/", nil))
+	if got, want := rec.Body.String(), "<h1>admin</h1>bye ai"; got != want {
+		t.Errorf("dev mode body %q, want %q", got, want)
+	}
+}
+
+func Test_TemplateRendererConcurrent(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.html": {Data: []byte(`<p>{{cspNonce}}</p>`)},
+	}
+	r, err := NewTemplateRenderer(fsys, nil, "page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New()
+	srv.Renderer = r
+	srv.Use(SecureWithConfig(SecureConfig{ContentSecurityPolicy: "{nonce}"}))
+	srv.GET("/", func(c Context) aicode.HTTPError {
+		c.Render(http.StatusOK, "page.html", nil)
+		return nil
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				rec := httptest.NewRecorder()
+				srv.ServeHTTP(rec, httptest.NewRequest(GET, "/", nil))
+				nonce := rec.Header().Get(HeaderContentSecurityPolicy)
+				if got, want := rec.Body.String(), "<p>"+nonce+"</p>"; got != want {
+					t.Errorf("body %q, want %q", got, want)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,71 @@
+package httpmux
+
+import (
+	"aicode"
+	"crypto/rand"
+	"encoding/hex"
+)
+
+// RequestIDConfig defines the config for RequestID middleware.
+type RequestIDConfig struct {
+	// Generator returns a new request ID. Default returns 16 random bytes in
+	// hex.
+	Generator func() string
+}
+
+// requestIDKey is the Context key of the request ID.
+const requestIDKey = "httpmux.request_id"
+
+// maxRequestIDLen bounds the length of a request ID taken from the client.
+const maxRequestIDLen = 128
+
+// RequestID returns a middleware which reads the X-Request-ID request header,
+// or generates an ID when it is missing or malformed, stores it in the
+// Context and echoes it in the response header.
+func RequestID() Middleware {
+	return RequestIDWithConfig(RequestIDConfig{})
+}
+
+// RequestIDWithConfig returns a RequestID middleware with config.
+func RequestIDWithConfig(config RequestIDConfig) Middleware {
+	if config.Generator == nil {
+		config.Generator = randomID
+	}
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			id := c.Request().Header.Get(HeaderXRequestID)
+			if !validRequestID(id) {
+				id = config.Generator()
+			}
+			c.Set(requestIDKey, id)
+			c.Response().Header().Set(HeaderXRequestID, id)
+			return next(c)
+		}
+	}
+}
+
+// RequestIDFrom returns the request ID stored by the RequestID middleware, or
+// "" if there is none.
+func RequestIDFrom(c Context) string {
+	id, _ := c.Get(requestIDKey).(string)
+	return id
+}
+
+// validRequestID rejects IDs which could break a log line.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func randomID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -96,6 +96,9 @@ func (r *Response) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 // This mechanism can be used to cancel long operations on the server if the
 // client has disconnected before the response is ready.
 // See [http.CloseNotifier](https://golang.org/pkg/net/http/#CloseNotifier)
+//
+// Deprecated: use Context.Context, which is cancelled when the client goes
+// away.
 func (r *Response) CloseNotify() <-chan bool {
 	return r.Writer.(http.CloseNotifier).CloseNotify()
 }
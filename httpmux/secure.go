@@ -0,0 +1,166 @@
+package httpmux
+
+import (
+	"aicode"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// SecureConfig defines the config for Secure middleware. Empty fields are not
+// sent.
+type SecureConfig struct {
+	// XSSProtection is the X-XSS-Protection header.
+	XSSProtection string
+
+	// ContentTypeNosniff is the X-Content-Type-Options header.
+	ContentTypeNosniff string
+
+	// XFrameOptions is the X-Frame-Options header, e.g. "DENY".
+	XFrameOptions string
+
+	// HSTSMaxAge is the max-age in seconds of the Strict-Transport-Security
+	// header, which is only sent over HTTPS. Zero disables HSTS.
+	HSTSMaxAge int
+
+	// HSTSIncludeSubdomains applies HSTS to all subdomains.
+	HSTSIncludeSubdomains bool
+
+	// HSTSPreload asks for inclusion in the browsers' HSTS preload lists.
+	HSTSPreload bool
+
+	// ContentSecurityPolicy is the Content-Security-Policy header. Every
+	// "{nonce}" in it is replaced by a random nonce generated per request and
+	// available to handles and templates, e.g.
+	// "script-src 'self' 'nonce-{nonce}'" with
+	// <script nonce="{{cspNonce}}">.
+	ContentSecurityPolicy string
+
+	// CSPReportOnly sends the policy as Content-Security-Policy-Report-Only.
+	CSPReportOnly bool
+
+	// ReferrerPolicy is the Referrer-Policy header.
+	ReferrerPolicy string
+
+	// PermissionsPolicy is the Permissions-Policy header, e.g.
+	// "camera=(), geolocation=()".
+	PermissionsPolicy string
+
+	// HTTPSRedirect redirects requests made over plain HTTP to HTTPS, with
+	// 301 for GET and HEAD and 308 for the other methods.
+	HTTPSRedirect bool
+
+	// HTTPSHost is the host of the redirect. Default is the request host.
+	HTTPSHost string
+}
+
+// cspNonceKey is the Context store key of the CSP nonce.
+const cspNonceKey = "httpmux.csp_nonce"
+
+// DefaultSecureConfig is the default Secure middleware config.
+var DefaultSecureConfig = SecureConfig{
+	XSSProtection:         "0",
+	ContentTypeNosniff:    "nosniff",
+	XFrameOptions:         "SAMEORIGIN",
+	HSTSMaxAge:            365 * 24 * 3600,
+	HSTSIncludeSubdomains: true,
+	ReferrerPolicy:        "strict-origin-when-cross-origin",
+	PermissionsPolicy:     "camera=(), geolocation=(), payment=()",
+}
+
+// Secure returns a middleware which sets security headers with
+// DefaultSecureConfig.
+func Secure() Middleware {
+	return SecureWithConfig(DefaultSecureConfig)
+}
+
+// SecureWithConfig returns a Secure middleware with config. See Secure.
+//
+// Secure middleware of a route or group overrides the one of the server: its
+// config replaces the headers set by the outer one, including removing the
+// headers it leaves empty. The CSP nonce of the request is kept, so that
+// templates and headers agree.
+func SecureWithConfig(config SecureConfig) Middleware {
+	hsts := ""
+	if config.HSTSMaxAge > 0 {
+		hsts = fmt.Sprintf("max-age=%d", config.HSTSMaxAge)
+		if config.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		if config.HSTSPreload {
+			hsts += "; preload"
+		}
+	}
+	cspHeader, cspOther := HeaderContentSecurityPolicy, HeaderContentSecurityPolicyRO
+	if config.CSPReportOnly {
+		cspHeader, cspOther = cspOther, cspHeader
+	}
+
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			req := c.Request()
+			https := c.Scheme() == "https"
+			if config.HTTPSRedirect && !https {
+				host := config.HTTPSHost
+				if host == "" {
+					host = req.Host
+				}
+				code := http.StatusPermanentRedirect
+				if req.Method == GET || req.Method == HEAD {
+					code = http.StatusMovedPermanently
+				}
+				c.Redirect(code, "https://"+host+req.URL.RequestURI())
+				return nil
+			}
+
+			h := c.Response().Header()
+			setHeader(h, HeaderXXSSProtection, config.XSSProtection)
+			setHeader(h, HeaderXContentTypeOptions, config.ContentTypeNosniff)
+			setHeader(h, HeaderXFrameOptions, config.XFrameOptions)
+			if https {
+				setHeader(h, HeaderStrictTransportSecurity, hsts)
+			}
+			setHeader(h, HeaderReferrerPolicy, config.ReferrerPolicy)
+			setHeader(h, HeaderPermissionsPolicy, config.PermissionsPolicy)
+
+			csp := config.ContentSecurityPolicy
+			if strings.Contains(csp, "{nonce}") {
+				csp = strings.Replace(csp, "{nonce}", cspNonce(c), -1)
+			}
+			h.Del(cspOther)
+			setHeader(h, cspHeader, csp)
+			return next(c)
+		}
+	}
+}
+
+// CSPNonce returns the Content-Security-Policy nonce of the request, or "" if
+// the Secure middleware policy has none. Templates rendered by a
+// TemplateRenderer get it from the cspNonce function.
+func CSPNonce(c Context) string {
+	nonce, _ := c.Get(cspNonceKey).(string)
+	return nonce
+}
+
+// cspNonce returns the nonce of the request, generating it on first use.
+func cspNonce(c Context) string {
+	if nonce := CSPNonce(c); nonce != "" {
+		return nonce
+	}
+	b := make([]byte, 16)
+	rand.Read(b)
+	nonce := base64.RawURLEncoding.EncodeToString(b)
+	c.Set(cspNonceKey, nonce)
+	return nonce
+}
+
+// setHeader sets the header to value, or removes it when value is empty.
+func setHeader(h http.Header, key, value string) {
+	if value == "" {
+		h.Del(key)
+		return
+	}
+	h.Set(key, value)
+}
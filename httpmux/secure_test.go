@@ -0,0 +1,74 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_Secure(t *testing.T) {
+	fsys := fstest.MapFS{
+		"page.html": {Data: []byte(`<script nonce="{{cspNonce}}">go()</script>`)},
+	}
+	r, err := NewTemplateRenderer(fsys, nil, "page.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := New()
+	srv.Renderer = r
+	srv.SetTrustedProxies("192.0.2.0/24")
+	config := DefaultSecureConfig
+	config.HSTSPreload = true
+	config.ContentSecurityPolicy = "script-src 'self' 'nonce-{nonce}'"
+	srv.Use(SecureWithConfig(config))
+	srv.GET("/page", func(c Context) aicode.HTTPError {
+		c.Render(http.StatusOK, "page.html", nil)
+		return nil
+	})
+	srv.GET("/embed", func(c Context) aicode.HTTPError {
+		c.NoContent(http.StatusNoContent)
+		return nil
+	}, SecureWithConfig(SecureConfig{ContentSecurityPolicy: "frame-ancestors *", CSPReportOnly: true}))
+
+	req := httptest.NewRequest(GET, "/page", nil)
+	req.Header.Set(HeaderXForwardedProto, "https")
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	h := rec.Header()
+	if got := h.Get(HeaderStrictTransportSecurity); got != "max-age=31536000; includeSubDomains; preload" {
+		t.Errorf("HSTS %q", got)
+	}
+	if h.Get(HeaderXFrameOptions) != "SAMEORIGIN" || h.Get(HeaderReferrerPolicy) == "" || h.Get(HeaderPermissionsPolicy) == "" {
+		t.Errorf("headers %v", h)
+	}
+	csp := h.Get(HeaderContentSecurityPolicy)
+	nonce := strings.TrimSuffix(strings.TrimPrefix(csp, "script-src 'self' 'nonce-"), "'")
+	if len(nonce) < 20 || !strings.Contains(rec.Body.String(), `nonce="`+nonce+`"`) {
+		t.Errorf("CSP %q, body %q", csp, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/page", nil))
+	if h := rec.Header(); h.Get(HeaderStrictTransportSecurity) != "" || h.Get(HeaderContentSecurityPolicy) == csp {
+		t.Errorf("plain HTTP headers %v", h)
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/embed", nil))
+	h = rec.Header()
+	if h.Get(HeaderXFrameOptions) != "" || h.Get(HeaderContentSecurityPolicy) != "" || h.Get(HeaderContentSecurityPolicyRO) != "frame-ancestors *" {
+		t.Errorf("override headers %v", h)
+	}
+
+	srv = New()
+	srv.Use(SecureWithConfig(SecureConfig{HTTPSRedirect: true}))
+	srv.POST("/login", func(c Context) aicode.HTTPError { return nil })
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(POST, "http://example.com/login?next=%2F", nil))
+	if rec.Code != http.StatusPermanentRedirect || rec.Header().Get(HeaderLocation) != "https://example.com/login?next=%2F" {
+		t.Errorf("redirect %d %q", rec.Code, rec.Header().Get(HeaderLocation))
+	}
+}
@@ -0,0 +1,147 @@
+package httpmux
+
+import (
+	stdContext "context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// OnStart registers a function which is called once the server is listening,
+// before it accepts connections.
+func (r *server) OnStart(fn func()) {
+	r.lifeMu.Lock()
+	r.startHooks = append(r.startHooks, fn)
+	r.lifeMu.Unlock()
+}
+
+// OnShutdown registers a function which is called by Shutdown after in-flight
+// requests are drained, e.g. to close grpcpool connections or flush logs.
+// Hooks run in the order they were registered. They do not run when draining
+// did not finish in time, see Shutdown.
+func (r *server) OnShutdown(fn func()) {
+	r.lifeMu.Lock()
+	r.shutdownHooks = append(r.shutdownHooks, fn)
+	r.lifeMu.Unlock()
+}
+
+// Start starts an HTTP server on addr. It blocks until the server fails, or
+// until Shutdown is called and has finished draining, in which case it
+// returns nil.
+func (r *server) Start(addr string) error {
+	return r.start(addr, func(srv *http.Server, l net.Listener) error {
+		return srv.Serve(l)
+	})
+}
+
+// StartTLS starts an HTTPS server on addr. See Start.
+func (r *server) StartTLS(addr, certFile, keyFile string) error {
+	return r.start(addr, func(srv *http.Server, l net.Listener) error {
+		return srv.ServeTLS(l, certFile, keyFile)
+	})
+}
+
+func (r *server) start(addr string, serve func(*http.Server, net.Listener) error) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	srv := &http.Server{
+		Handler:      r,
+		ReadTimeout:  r.ReadTimeout,
+		WriteTimeout: r.WriteTimeout,
+		IdleTimeout:  r.IdleTimeout,
+	}
+
+	r.lifeMu.Lock()
+	if r.httpServer != nil {
+		r.lifeMu.Unlock()
+		l.Close()
+		return errors.New("server already started")
+	}
+	r.httpServer, r.listener = srv, l
+	r.stopped = make(chan struct{})
+	stopped, hooks := r.stopped, r.startHooks
+	r.lifeMu.Unlock()
+
+	for _, fn := range hooks {
+		fn()
+	}
+	if err = serve(srv, l); err != http.ErrServerClosed {
+		// The server failed on its own: release the lifecycle state so that
+		// it can be started again and a pending Shutdown returns.
+		r.release(stopped)
+		return err
+	}
+	<-stopped
+	return nil
+}
+
+// release clears the lifecycle state of the run which stopped belongs to and
+// closes stopped. It does nothing if that run was released already.
+func (r *server) release(stopped chan struct{}) {
+	r.lifeMu.Lock()
+	if r.stopped == stopped {
+		close(stopped)
+		r.httpServer, r.listener, r.stopped = nil, nil, nil
+	}
+	r.lifeMu.Unlock()
+}
+
+// Addr returns the address the server is listening on, or nil before Start.
+func (r *server) Addr() net.Addr {
+	r.lifeMu.Lock()
+	defer r.lifeMu.Unlock()
+	if r.listener == nil {
+		return nil
+	}
+	return r.listener.Addr()
+}
+
+// Shutdown gracefully shuts down the server: it stops accepting connections,
+// waits for in-flight requests until ctx is done, then runs the OnShutdown
+// hooks.
+//
+// If ctx is done before the requests are drained, the remaining connections
+// are closed and the hooks are skipped, since handlers may still be running
+// and using what the hooks release. Shutdown then returns the ctx error.
+func (r *server) Shutdown(ctx stdContext.Context) error {
+	r.lifeMu.Lock()
+	srv, stopped, hooks := r.httpServer, r.stopped, r.shutdownHooks
+	r.lifeMu.Unlock()
+	if srv == nil {
+		return nil
+	}
+	err := srv.Shutdown(ctx)
+	if err != nil {
+		srv.Close()
+	} else {
+		for _, fn := range hooks {
+			fn()
+		}
+	}
+
+	r.release(stopped)
+	return err
+}
+
+// ShutdownOnSignal calls Shutdown with the given drain timeout when one of
+// sig is received. SIGINT and SIGTERM are used when sig is empty.
+func (r *server) ShutdownOnSignal(timeout time.Duration, sig ...os.Signal) {
+	if len(sig) == 0 {
+		sig = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sig...)
+	go func() {
+		<-ch
+		signal.Stop(ch)
+		ctx, cancel := stdContext.WithTimeout(stdContext.Background(), timeout)
+		defer cancel()
+		r.Shutdown(ctx)
+	}()
+}
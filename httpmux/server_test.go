@@ -0,0 +1,118 @@
+package httpmux
+
+import (
+	"aicode"
+	stdContext "context"
+	"io/ioutil"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func Test_StartShutdown(t *testing.T) {
+	srv := New()
+	release := make(chan struct{})
+	srv.GET("/slow", func(c Context) aicode.HTTPError {
+		<-release
+		c.String(http.StatusOK, "done")
+		return nil
+	})
+	started := make(chan struct{})
+	var hooks []string
+	srv.OnStart(func() { close(started) })
+	srv.OnShutdown(func() { hooks = append(hooks, "closed") })
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.Start("127.0.0.1:0") }()
+	<-started
+
+	body := make(chan string, 1)
+	go func() {
+		rsp, err := http.Get("http://" + srv.Addr().String() + "/slow")
+		if err != nil {
+			body <- err.Error()
+			return
+		}
+		defer rsp.Body.Close()
+		b, _ := ioutil.ReadAll(rsp.Body)
+		body <- string(b)
+	}()
+	time.Sleep(50 * time.Millisecond)
+
+	shutdownErr := make(chan error, 1)
+	go func() { shutdownErr <- srv.Shutdown(stdContext.Background()) }()
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if got := <-body; got != "done" {
+		t.Errorf("in-flight request got %q", got)
+	}
+	if err := <-shutdownErr; err != nil {
+		t.Errorf("shutdown: %v", err)
+	}
+	if err := <-startErr; err != nil {
+		t.Errorf("start: %v", err)
+	}
+	if len(hooks) != 1 {
+		t.Errorf("shutdown hooks %v", hooks)
+	}
+}
+
+func Test_StartFailure(t *testing.T) {
+	srv := New()
+	if err := srv.StartTLS("127.0.0.1:0", "missing.crt", "missing.key"); err == nil {
+		t.Fatal("StartTLS without certificates succeeded")
+	}
+	if srv.Addr() != nil {
+		t.Error("failed start left its listener")
+	}
+	if err := srv.Shutdown(stdContext.Background()); err != nil {
+		t.Errorf("shutdown after failed start: %v", err)
+	}
+
+	started := make(chan struct{})
+	srv.OnStart(func() { close(started) })
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.Start("127.0.0.1:0") }()
+	select {
+	case <-started:
+	case err := <-startErr:
+		t.Fatalf("restart after failure: %v", err)
+	}
+	srv.Shutdown(stdContext.Background())
+	if err := <-startErr; err != nil {
+		t.Errorf("Start returned %v", err)
+	}
+}
+
+func Test_ShutdownTimeout(t *testing.T) {
+	srv := New()
+	release := make(chan struct{})
+	defer close(release)
+	srv.GET("/stuck", func(c Context) aicode.HTTPError {
+		<-release
+		return nil
+	})
+	started := make(chan struct{})
+	hooked := false
+	srv.OnStart(func() { close(started) })
+	srv.OnShutdown(func() { hooked = true })
+
+	startErr := make(chan error, 1)
+	go func() { startErr <- srv.Start("127.0.0.1:0") }()
+	<-started
+	go http.Get("http://" + srv.Addr().String() + "/stuck")
+	time.Sleep(50 * time.Millisecond)
+
+	ctx, cancel := stdContext.WithTimeout(stdContext.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != stdContext.DeadlineExceeded {
+		t.Errorf("shutdown: %v", err)
+	}
+	if hooked {
+		t.Error("shutdown hooks ran while a request was in flight")
+	}
+	if err := <-startErr; err != nil {
+		t.Errorf("Start returned %v", err)
+	}
+}
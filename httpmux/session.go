@@ -0,0 +1,508 @@
+package httpmux
+
+import (
+	"aicode"
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/gob"
+	"errors"
+	"fmt"
+	"logger"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// SessionStore keeps session values. The cookie holds the value returned
+	// by Save, which the next request passes to Load.
+	SessionStore interface {
+		// Load returns the session referenced by a cookie value. It returns an
+		// empty id when the session does not exist, expired or the value is
+		// not authentic.
+		Load(value string) (id string, values map[string]interface{}, err error)
+
+		// Save stores the session values for maxAge and returns the cookie
+		// value referencing them.
+		Save(id string, values map[string]interface{}, maxAge time.Duration) (value string, err error)
+
+		// Delete removes the session with id.
+		Delete(id string) error
+	}
+
+	// SessionConfig defines the config for Sessions middleware.
+	SessionConfig struct {
+		// Store keeps the sessions. Default is a MemorySessionStore evicting
+		// sessions idle for MaxAge.
+		Store SessionStore
+
+		// CookieName is the name of the session cookie. Default is "session".
+		CookieName string
+
+		// CookiePath and CookieDomain scope the session cookie.
+		// Default path is "/".
+		CookiePath   string
+		CookieDomain string
+
+		// MaxAge is the lifetime of a session after its last change.
+		// Default is 24 hours.
+		MaxAge time.Duration
+
+		// CookieSameSite is the SameSite attribute of the session cookie.
+		// Default is http.SameSiteLaxMode.
+		CookieSameSite http.SameSite
+
+		// InsecureCookie drops the Secure attribute, which is otherwise always
+		// set. Browsers accept Secure cookies from http://localhost, so it is
+		// only needed for plain HTTP on other hosts.
+		InsecureCookie bool
+
+		// Logger receives the errors of saving sessions, which happens while
+		// the response is written. Default is logger.GetInstance().
+		Logger *logger.Ailog
+	}
+
+	// Session is the session of a request, returned by Context.Session. Its
+	// changes are saved when the response is written.
+	Session struct {
+		config  *SessionConfig
+		cookie  string
+		loaded  bool
+		id      string
+		oldID   string
+		values  map[string]interface{}
+		isNew   bool
+		changed bool
+		deleted bool
+		saved   bool
+	}
+
+	// CookieSessionStore keeps the session values in the cookie itself,
+	// signed and optionally encrypted. Values are encoded with encoding/gob,
+	// so types other than the basic ones must be registered with gob.Register.
+	//
+	// Its sessions cannot be revoked: a cookie copied before Rotate or
+	// Destroy keeps loading, with the values it held then, until MaxAge
+	// passed. Use a store keeping the sessions on the server, such as
+	// MemorySessionStore, when a logout must end the session at once.
+	CookieSessionStore struct {
+		hashKey []byte
+		aead    cipher.AEAD
+	}
+
+	// MemorySessionStore keeps sessions in memory. Sessions which were not
+	// loaded or saved for the ttl duration are evicted.
+	MemorySessionStore struct {
+		ttl       time.Duration
+		mu        sync.Mutex
+		sessions  map[string]*memorySession
+		lastSweep time.Time
+	}
+
+	memorySession struct {
+		values   map[string]interface{}
+		expires  time.Time
+		lastSeen time.Time
+	}
+
+	// cookieSession is the gob encoded content of a session cookie.
+	cookieSession struct {
+		ID      string
+		Values  map[string]interface{}
+		Expires int64
+	}
+)
+
+const (
+	sessionKey = "httpmux.session"
+	flashKey   = "_flash"
+
+	// maxCookieSize is the largest cookie value accepted by all browsers.
+	maxCookieSize = 4000
+)
+
+// ErrNoSession is returned by Context.Session when the Sessions middleware
+// did not run.
+var ErrNoSession = errors.New("httpmux: no session middleware")
+
+// DefaultSessionConfig is the default Sessions middleware config.
+var DefaultSessionConfig = SessionConfig{
+	CookieName:     "session",
+	CookiePath:     "/",
+	MaxAge:         24 * time.Hour,
+	CookieSameSite: http.SameSiteLaxMode,
+}
+
+func init() {
+	gob.Register([]interface{}{})
+	gob.Register(map[string]interface{}{})
+}
+
+// Sessions returns a middleware providing Context.Session with
+// DefaultSessionConfig and an in-memory store.
+func Sessions() Middleware {
+	return SessionsWithConfig(DefaultSessionConfig)
+}
+
+// SessionsWithConfig returns a Sessions middleware with config. See Sessions.
+//
+// The session is loaded on the first call to Context.Session, and saved when
+// the response is written if it changed. The cookie is HttpOnly and Secure.
+func SessionsWithConfig(config SessionConfig) Middleware {
+	if config.CookieName == "" {
+		config.CookieName = DefaultSessionConfig.CookieName
+	}
+	if config.CookiePath == "" {
+		config.CookiePath = DefaultSessionConfig.CookiePath
+	}
+	if config.MaxAge == 0 {
+		config.MaxAge = DefaultSessionConfig.MaxAge
+	}
+	if config.CookieSameSite == 0 {
+		config.CookieSameSite = DefaultSessionConfig.CookieSameSite
+	}
+	if config.Store == nil {
+		config.Store = NewMemorySessionStore(config.MaxAge)
+	}
+	if config.Logger == nil {
+		config.Logger = logger.GetInstance()
+	}
+
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			s := &Session{config: &config}
+			if ck, err := c.Request().Cookie(config.CookieName); err == nil {
+				s.cookie = ck.Value
+			}
+			c.Set(sessionKey, s)
+			rsp := c.Response()
+			rsp.Before(func() { s.save(c) })
+			err := next(c)
+			if !rsp.Committed {
+				s.save(c)
+			}
+			return err
+		}
+	}
+}
+
+func (c *context) Session() (*Session, error) {
+	s, ok := c.Get(sessionKey).(*Session)
+	if !ok {
+		return nil, ErrNoSession
+	}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *Session) load() error {
+	if s.loaded {
+		return nil
+	}
+	if s.cookie != "" {
+		id, values, err := s.config.Store.Load(s.cookie)
+		if err != nil {
+			return err
+		}
+		s.id, s.values = id, values
+	}
+	if s.id == "" {
+		s.id, s.values, s.isNew = newSessionID(), map[string]interface{}{}, true
+	}
+	if s.values == nil {
+		s.values = map[string]interface{}{}
+	}
+	s.loaded = true
+	return nil
+}
+
+// save stores a changed session and sets its cookie. It runs once, before
+// the response header is written.
+func (s *Session) save(c Context) {
+	if s.saved || !s.loaded {
+		return
+	}
+	s.saved = true
+	config := s.config
+	cookie := &http.Cookie{
+		Name:     config.CookieName,
+		Path:     config.CookiePath,
+		Domain:   config.CookieDomain,
+		Secure:   !config.InsecureCookie,
+		HttpOnly: true,
+		SameSite: config.CookieSameSite,
+	}
+	if s.oldID != "" {
+		if err := config.Store.Delete(s.oldID); err != nil {
+			config.Logger.Errorf("session delete %s: %v", RequestIDFrom(c), err)
+		}
+	}
+	if s.deleted {
+		if err := config.Store.Delete(s.id); err != nil {
+			config.Logger.Errorf("session delete %s: %v", RequestIDFrom(c), err)
+		}
+		if s.cookie != "" {
+			cookie.MaxAge = -1
+			http.SetCookie(c.Response(), cookie)
+		}
+		return
+	}
+	if !s.changed {
+		return
+	}
+	value, err := config.Store.Save(s.id, s.values, config.MaxAge)
+	if err != nil {
+		config.Logger.Errorf("session save %s: %v", RequestIDFrom(c), err)
+		return
+	}
+	cookie.Value = value
+	cookie.MaxAge = int(config.MaxAge / time.Second)
+	http.SetCookie(c.Response(), cookie)
+}
+
+// ID returns the session ID.
+func (s *Session) ID() string {
+	return s.id
+}
+
+// IsNew reports whether the request had no valid session.
+func (s *Session) IsNew() bool {
+	return s.isNew
+}
+
+// Get returns the value of key, or nil.
+func (s *Session) Get(key string) interface{} {
+	return s.values[key]
+}
+
+// Set sets the value of key.
+func (s *Session) Set(key string, val interface{}) {
+	s.values[key] = val
+	s.changed = true
+}
+
+// Delete removes key.
+func (s *Session) Delete(key string) {
+	if _, ok := s.values[key]; ok {
+		delete(s.values, key)
+		s.changed = true
+	}
+}
+
+// AddFlash adds a message read once by Flashes, usually on the next request
+// after a redirect.
+func (s *Session) AddFlash(val interface{}) {
+	// The slice may be shared with other requests by the store, copy it.
+	flashes, _ := s.values[flashKey].([]interface{})
+	s.Set(flashKey, append(flashes[:len(flashes):len(flashes)], val))
+}
+
+// Flashes returns the flash messages and removes them from the session.
+func (s *Session) Flashes() []interface{} {
+	flashes, _ := s.values[flashKey].([]interface{})
+	s.Delete(flashKey)
+	return flashes
+}
+
+// Rotate gives the session a new ID, keeping its values, and removes the old
+// one from the store. Call it on login and privilege changes so that a
+// session ID planted before cannot be used after. With a CookieSessionStore
+// the old cookie is not revoked, see CookieSessionStore.
+func (s *Session) Rotate() {
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = newSessionID()
+	s.changed = true
+}
+
+// Destroy removes the session from the store and expires its cookie.
+func (s *Session) Destroy() {
+	s.values = map[string]interface{}{}
+	s.deleted = true
+}
+
+// newSessionID returns a random session ID. Like the other random values of
+// the package, it relies on crypto/rand.Read, which never fails since Go 1.24.
+func newSessionID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// NewCookieSessionStore creates a CookieSessionStore. hashKey signs the
+// cookies. encryptKey, if not nil, encrypts them with AES-GCM and must be 16,
+// 24 or 32 bytes long.
+func NewCookieSessionStore(hashKey, encryptKey []byte) (*CookieSessionStore, error) {
+	if len(hashKey) == 0 {
+		return nil, errors.New("httpmux: empty session hash key")
+	}
+	s := &CookieSessionStore{hashKey: hashKey}
+	if encryptKey != nil {
+		block, err := aes.NewCipher(encryptKey)
+		if err != nil {
+			return nil, fmt.Errorf("httpmux: session encrypt key: %v", err)
+		}
+		if s.aead, err = cipher.NewGCM(block); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// Load implements the SessionStore interface.
+func (s *CookieSessionStore) Load(value string) (string, map[string]interface{}, error) {
+	payload := s.open(value)
+	if payload == nil {
+		return "", nil, nil
+	}
+	var cs cookieSession
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(&cs); err != nil {
+		return "", nil, nil
+	}
+	if time.Now().Unix() > cs.Expires {
+		return "", nil, nil
+	}
+	return cs.ID, cs.Values, nil
+}
+
+// Save implements the SessionStore interface.
+func (s *CookieSessionStore) Save(id string, values map[string]interface{}, maxAge time.Duration) (string, error) {
+	var buf bytes.Buffer
+	cs := cookieSession{ID: id, Values: values, Expires: time.Now().Add(maxAge).Unix()}
+	if err := gob.NewEncoder(&buf).Encode(&cs); err != nil {
+		return "", err
+	}
+	value := s.seal(buf.Bytes())
+	if len(value) > maxCookieSize {
+		return "", fmt.Errorf("httpmux: session cookie of %d bytes is too large", len(value))
+	}
+	return value, nil
+}
+
+// Delete implements the SessionStore interface. Cookie sessions are removed
+// by expiring the cookie.
+func (s *CookieSessionStore) Delete(id string) error {
+	return nil
+}
+
+func (s *CookieSessionStore) mac(b []byte) []byte {
+	m := hmac.New(sha256.New, s.hashKey)
+	m.Write(b)
+	return m.Sum(nil)
+}
+
+func (s *CookieSessionStore) seal(payload []byte) string {
+	if s.aead != nil {
+		nonce := make([]byte, s.aead.NonceSize())
+		rand.Read(nonce)
+		payload = s.aead.Seal(nonce, nonce, payload, nil)
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(s.mac(payload))
+}
+
+// open returns the payload of a cookie value, or nil if it was not sealed by
+// s.
+func (s *CookieSessionStore) open(value string) []byte {
+	i := strings.IndexByte(value, '.')
+	if i < 0 {
+		return nil
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(value[:i])
+	if err != nil {
+		return nil
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(value[i+1:])
+	if err != nil || !hmac.Equal(sig, s.mac(payload)) {
+		return nil
+	}
+	if s.aead == nil {
+		return payload
+	}
+	n := s.aead.NonceSize()
+	if len(payload) < n {
+		return nil
+	}
+	payload, err = s.aead.Open(nil, payload[:n], payload[n:], nil)
+	if err != nil {
+		return nil
+	}
+	return payload
+}
+
+// NewMemorySessionStore creates a MemorySessionStore evicting sessions idle
+// for ttl.
+func NewMemorySessionStore(ttl time.Duration) *MemorySessionStore {
+	return &MemorySessionStore{ttl: ttl, sessions: make(map[string]*memorySession)}
+}
+
+// Load implements the SessionStore interface. The cookie value is the
+// session ID.
+func (s *MemorySessionStore) Load(value string) (string, map[string]interface{}, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	ms, ok := s.sessions[value]
+	if !ok || now.After(ms.expires) || now.Sub(ms.lastSeen) >= s.ttl {
+		return "", nil, nil
+	}
+	ms.lastSeen = now
+	return value, copyValues(ms.values), nil
+}
+
+// Save implements the SessionStore interface.
+func (s *MemorySessionStore) Save(id string, values map[string]interface{}, maxAge time.Duration) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.sweep(now)
+	s.sessions[id] = &memorySession{values: copyValues(values), expires: now.Add(maxAge), lastSeen: now}
+	return id, nil
+}
+
+// Delete implements the SessionStore interface.
+func (s *MemorySessionStore) Delete(id string) error {
+	s.mu.Lock()
+	delete(s.sessions, id)
+	s.mu.Unlock()
+	return nil
+}
+
+// Len returns the number of sessions in the store.
+func (s *MemorySessionStore) Len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.sessions)
+}
+
+func (s *MemorySessionStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < s.ttl {
+		return
+	}
+	for id, ms := range s.sessions {
+		if now.Sub(ms.lastSeen) >= s.ttl || now.After(ms.expires) {
+			delete(s.sessions, id)
+		}
+	}
+	s.lastSweep = now
+}
+
+// copyValues copies the top level of a session, so that requests sharing a
+// session do not share its map. The values themselves are shared, so they are
+// replaced rather than modified in place.
+func copyValues(values map[string]interface{}) map[string]interface{} {
+	c := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		c[k] = v
+	}
+	return c
+}
@@ -0,0 +1,167 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func sessionServer(t *testing.T, config SessionConfig) *server {
+	srv := New()
+	srv.Use(SessionsWithConfig(config))
+	srv.POST("/login", func(c Context) aicode.HTTPError {
+		s, err := c.Session()
+		if err != nil {
+			t.Error(err)
+			return aicode.ComInnerError
+		}
+		s.Rotate()
+		s.Set("user", "alice")
+		s.AddFlash("welcome")
+		c.NoContent(http.StatusNoContent)
+		return nil
+	})
+	srv.GET("/me", func(c Context) aicode.HTTPError {
+		s, _ := c.Session()
+		user, _ := s.Get("user").(string)
+		var flashes []string
+		for _, f := range s.Flashes() {
+			flashes = append(flashes, f.(string))
+		}
+		c.String(http.StatusOK, user+" "+strings.Join(flashes, ","))
+		return nil
+	})
+	srv.POST("/logout", func(c Context) aicode.HTTPError {
+		s, _ := c.Session()
+		s.Destroy()
+		return nil
+	})
+	return srv
+}
+
+func sessionDo(srv *server, method, path string, cookie *http.Cookie) (*httptest.ResponseRecorder, *http.Cookie) {
+	req := httptest.NewRequest(method, path, nil)
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	for _, ck := range rec.Result().Cookies() {
+		return rec, ck
+	}
+	return rec, cookie
+}
+
+func Test_Session(t *testing.T) {
+	cookieStore, err := NewCookieSessionStore([]byte("hash"), []byte("0123456789abcdef"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	memStore := NewMemorySessionStore(time.Hour)
+	for name, store := range map[string]SessionStore{"cookie": cookieStore, "memory": memStore} {
+		srv := sessionServer(t, SessionConfig{Store: store})
+
+		rec, ck := sessionDo(srv, GET, "/me", nil)
+		if ck != nil || rec.Body.String() != " " {
+			t.Errorf("%s: unchanged session set cookie %v", name, ck)
+		}
+		_, ck = sessionDo(srv, POST, "/login", nil)
+		if ck == nil || !ck.HttpOnly || !ck.Secure || ck.SameSite != http.SameSiteLaxMode {
+			t.Fatalf("%s: login cookie %v", name, ck)
+		}
+		if strings.Contains(ck.Value, "alice") {
+			t.Errorf("%s: cookie leaks values: %q", name, ck.Value)
+		}
+		rec, ck2 := sessionDo(srv, GET, "/me", ck)
+		if rec.Body.String() != "alice welcome" {
+			t.Errorf("%s: first read %q", name, rec.Body.String())
+		}
+		rec, ck2 = sessionDo(srv, GET, "/me", ck2)
+		if rec.Body.String() != "alice " {
+			t.Errorf("%s: flash not consumed: %q", name, rec.Body.String())
+		}
+
+		_, rotated := sessionDo(srv, POST, "/login", ck2)
+		if rotated.Value == ck2.Value {
+			t.Errorf("%s: session not rotated", name)
+		}
+		_, gone := sessionDo(srv, POST, "/logout", rotated)
+		if gone.MaxAge >= 0 {
+			t.Errorf("%s: logout cookie %v", name, gone)
+		}
+		rec, _ = sessionDo(srv, GET, "/me", ck2)
+		switch {
+		case name == "memory" && rec.Body.String() != " ":
+			t.Errorf("pre-rotation session still valid: %q", rec.Body.String())
+		case name == "cookie" && rec.Body.String() != "alice ":
+			// Cookie sessions are not revoked, the old cookie loads until it
+			// expires.
+			t.Errorf("pre-rotation cookie: %q", rec.Body.String())
+		}
+		if name == "memory" {
+			if rec, _ := sessionDo(srv, GET, "/me", rotated); rec.Body.String() != " " {
+				t.Errorf("destroyed session still valid: %q", rec.Body.String())
+			}
+			if n := memStore.Len(); n != 0 {
+				t.Errorf("%d sessions left after rotation and logout", n)
+			}
+		}
+
+		tampered := &http.Cookie{Name: ck.Name, Value: "x" + ck.Value}
+		if rec, _ := sessionDo(srv, GET, "/me", tampered); rec.Body.String() != " " {
+			t.Errorf("%s: tampered cookie accepted: %q", name, rec.Body.String())
+		}
+	}
+
+	srv := New()
+	srv.GET("/", func(c Context) aicode.HTTPError {
+		if _, err := c.Session(); err != ErrNoSession {
+			t.Errorf("session without middleware: %v", err)
+		}
+		return nil
+	})
+	srv.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(GET, "/", nil))
+}
+
+func Test_MemorySessionStoreTTL(t *testing.T) {
+	store := NewMemorySessionStore(20 * time.Millisecond)
+	store.Save("a", map[string]interface{}{"k": 1}, time.Hour)
+	if id, values, _ := store.Load("a"); id != "a" || values["k"] != 1 {
+		t.Fatalf("load %q %v", id, values)
+	}
+	time.Sleep(30 * time.Millisecond)
+	if id, _, _ := store.Load("a"); id != "" {
+		t.Error("idle session not evicted")
+	}
+	if store.Len() != 0 {
+		t.Errorf("store holds %d sessions", store.Len())
+	}
+}
+
+func Test_SessionFlashRace(t *testing.T) {
+	store := NewMemorySessionStore(time.Hour)
+	store.Save("a", map[string]interface{}{flashKey: make([]interface{}, 1, 8)}, time.Hour)
+	config := &SessionConfig{Store: store}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			s := &Session{config: config, cookie: "a"}
+			if err := s.load(); err != nil {
+				t.Error(err)
+				return
+			}
+			s.AddFlash(i)
+			if flashes := s.Flashes(); len(flashes) != 2 || flashes[1] != i {
+				t.Errorf("flashes %v", flashes)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
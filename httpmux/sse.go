@@ -0,0 +1,153 @@
+package httpmux
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+type (
+	// Event is a Server-Sent Event. Empty fields are not sent.
+	Event struct {
+		ID    string
+		Event string
+		Data  string
+		Retry time.Duration
+	}
+
+	// EventStream writes Server-Sent Events to the client. It is safe for
+	// concurrent use.
+	EventStream struct {
+		c      Context
+		mu     sync.Mutex
+		closed bool
+		stop   chan struct{}
+	}
+)
+
+// DefaultSSEHeartbeat is the default interval of EventStream heartbeats.
+const DefaultSSEHeartbeat = 15 * time.Second
+
+var errStreamClosed = errors.New("event stream closed")
+
+var newlineReplacer = strings.NewReplacer("\r\n", "\n", "\r", "\n")
+
+func (c *context) SSE() (*EventStream, error) {
+	if _, ok := c.response.Writer.(http.Flusher); !ok {
+		return nil, errors.New("response writer does not support flushing")
+	}
+	h := c.response.Header()
+	h.Set(HeaderContentType, MIMETextEventStream)
+	h.Set(HeaderCacheControl, "no-cache")
+	h.Set("X-Accel-Buffering", "no")
+	c.response.WriteHeader(http.StatusOK)
+	c.response.Flush()
+
+	interval := c.mux.SSEHeartbeat
+	if interval == 0 {
+		interval = DefaultSSEHeartbeat
+	}
+	s := &EventStream{c: c, stop: make(chan struct{})}
+	go s.heartbeat(interval)
+	return s, nil
+}
+
+// heartbeat writes a comment every interval, so that proxies keep the
+// connection open, until the stream is closed or the request is done.
+func (s *EventStream) heartbeat(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			return
+		case <-s.Done():
+			s.Close()
+			return
+		case <-ticker.C:
+			if s.write([]byte(": ping\n\n")) != nil {
+				return
+			}
+		}
+	}
+}
+
+// LastEventID returns the ID of the last event received by a reconnecting
+// client, from the Last-Event-ID header or the `lastEventId` query param.
+func (s *EventStream) LastEventID() string {
+	if id := s.c.Request().Header.Get(HeaderLastEventID); id != "" {
+		return id
+	}
+	return s.c.QueryParam("lastEventId")
+}
+
+// Done is closed when the client went away or the request timed out.
+func (s *EventStream) Done() <-chan struct{} {
+	return s.c.Context().Done()
+}
+
+// Send writes e and flushes it to the client. It fails once the request
+// context is done or the stream is closed.
+func (s *EventStream) Send(e Event) error {
+	var b bytes.Buffer
+	if e.ID != "" {
+		b.WriteString("id: " + singleLine(e.ID) + "\n")
+	}
+	if e.Event != "" {
+		b.WriteString("event: " + singleLine(e.Event) + "\n")
+	}
+	if e.Retry > 0 {
+		b.WriteString("retry: " + strconv.FormatInt(int64(e.Retry/time.Millisecond), 10) + "\n")
+	}
+	for _, line := range strings.Split(newlineReplacer.Replace(e.Data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	return s.write(b.Bytes())
+}
+
+// SendJSON sends v encoded as JSON as the data of an event named event.
+func (s *EventStream) SendJSON(id, event string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return s.Send(Event{ID: id, Event: event, Data: string(data)})
+}
+
+func (s *EventStream) write(b []byte) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errStreamClosed
+	}
+	if err := s.c.Context().Err(); err != nil {
+		return err
+	}
+	rsp := s.c.Response()
+	if _, err := rsp.Write(b); err != nil {
+		return err
+	}
+	rsp.Flush()
+	return nil
+}
+
+// Close stops the heartbeat. It must be called before the handle returns,
+// after which the response can't be written anymore.
+func (s *EventStream) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.stop)
+	}
+}
+
+func singleLine(s string) string {
+	return strings.NewReplacer("\r", "", "\n", "").Replace(s)
+}
@@ -0,0 +1,61 @@
+package httpmux
+
+import (
+	"aicode"
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_SSE(t *testing.T) {
+	srv := New()
+	srv.SSEHeartbeat = 20 * time.Millisecond
+	srv.GET("/results", func(c Context) aicode.HTTPError {
+		stream, err := c.SSE()
+		if err != nil {
+			t.Error(err)
+			return nil
+		}
+		defer stream.Close()
+		stream.Send(Event{ID: "1", Event: "sentence", Data: "resumed after " + stream.LastEventID()})
+		stream.SendJSON("2", "sentence", map[string]string{"text": "line\nbreak"})
+		stream.Send(Event{Data: "a\nb", Retry: 3 * time.Second})
+		<-stream.Done()
+		if err := stream.Send(Event{Data: "gone"}); err == nil {
+			t.Error("send after client went away succeeded")
+		}
+		return nil
+	})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+
+	req, _ := http.NewRequest(GET, ts.URL+"/results", nil)
+	req.Header.Set(HeaderLastEventID, "0")
+	rsp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rsp.Header.Get(HeaderContentType) != MIMETextEventStream {
+		t.Errorf("content type %q", rsp.Header.Get(HeaderContentType))
+	}
+	want := []string{
+		"id: 1", "event: sentence", "data: resumed after 0", "",
+		"id: 2", "event: sentence", `data: {"text":"line\nbreak"}`, "",
+		"retry: 3000", "data: a", "data: b", "",
+		": ping",
+	}
+	r := bufio.NewReader(rsp.Body)
+	for _, w := range want {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strings.TrimSuffix(line, "\n"); got != w {
+			t.Errorf("line %q, want %q", got, w)
+		}
+	}
+	rsp.Body.Close()
+}
@@ -0,0 +1,167 @@
+package httpmux
+
+import (
+	"aicode"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strings"
+)
+
+// StaticConfig defines the config for StaticWithConfig.
+type StaticConfig struct {
+	// Root is the directory to serve. It is ignored when FS is set.
+	Root string
+
+	// FS is the file system to serve, e.g. an embed.FS.
+	FS fs.FS
+
+	// Index is the file served for a directory. Default is "index.html".
+	Index string
+
+	// Precompressed serves the `.br` or `.gz` sibling of a file, when it exists
+	// and the client accepts that encoding.
+	Precompressed bool
+}
+
+// precompressed lists the encodings served from sibling files, preferred first.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Static serves the files in the root directory under prefix, e.g.
+// Static("/assets", "public") serves "public/css/app.css" at
+// "/assets/css/app.css".
+//
+// The prefix is registered as a catch-all route, so it can't be shared with
+// other routes, see httprouter.
+func (r *server) Static(prefix, root string, middleware ...Middleware) {
+	r.StaticWithConfig(prefix, StaticConfig{Root: root}, middleware...)
+}
+
+// StaticFS serves the files in fsys under prefix. See Static.
+func (r *server) StaticFS(prefix string, fsys fs.FS, middleware ...Middleware) {
+	r.StaticWithConfig(prefix, StaticConfig{FS: fsys}, middleware...)
+}
+
+// StaticWithConfig serves files under prefix with config. Missing files are
+// reported as aicode.ComNotExist.
+func (r *server) StaticWithConfig(prefix string, config StaticConfig, middleware ...Middleware) {
+	fsys := config.FS
+	if fsys == nil {
+		fsys = os.DirFS(config.Root)
+	}
+	if config.Index == "" {
+		config.Index = indexPage
+	}
+	h := func(c Context) aicode.HTTPError {
+		return serveFS(c, fsys, c.Param("filepath"), config.Index, config.Precompressed)
+	}
+	pattern := strings.TrimSuffix(prefix, "/") + "/*filepath"
+	r.GET(pattern, h, middleware...).Hide()
+	r.HEAD(pattern, h, middleware...).Hide()
+}
+
+// serveFS serves the file name from fsys, or the index file when name is a
+// directory. Conditional and range requests are handled by
+// http.ServeContent.
+func serveFS(c Context, fsys fs.FS, name, index string, compressed bool) aicode.HTTPError {
+	// Cleaning the rooted path removes every `..` which could escape fsys.
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		name = "."
+	}
+	if !fs.ValidPath(name) {
+		return aicode.ComNotExist
+	}
+	fi, err := fs.Stat(fsys, name)
+	if err != nil {
+		return fsError(err)
+	}
+	if fi.IsDir() {
+		name = path.Join(name, index)
+		if fi, err = fs.Stat(fsys, name); err != nil {
+			return fsError(err)
+		}
+		if fi.IsDir() {
+			return aicode.ComNotExist
+		}
+	}
+
+	rsp := c.Response()
+	served := name
+	if compressed {
+		rsp.Header().Add(HeaderVary, HeaderAcceptEncoding)
+		accept := c.Request().Header.Get(HeaderAcceptEncoding)
+		for _, pc := range precompressed {
+			if !acceptsEncoding(accept, pc.encoding) {
+				continue
+			}
+			if cfi, err := fs.Stat(fsys, name+pc.ext); err == nil && !cfi.IsDir() {
+				ctype := mime.TypeByExtension(path.Ext(name))
+				if ctype == "" {
+					ctype = MIMEOctetStream
+				}
+				rsp.Header().Set(HeaderContentType, ctype)
+				rsp.Header().Set(HeaderContentEncoding, pc.encoding)
+				served, fi = name+pc.ext, cfi
+				break
+			}
+		}
+	}
+
+	f, err := fsys.Open(served)
+	if err != nil {
+		return fsError(err)
+	}
+	defer f.Close()
+	content, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := ioutil.ReadAll(f)
+		if err != nil {
+			return fsError(err)
+		}
+		content = bytes.NewReader(b)
+	}
+	if rsp.Header().Get(HeaderETag) == "" {
+		rsp.Header().Set(HeaderETag, fmt.Sprintf(`"%x-%x"`, fi.ModTime().UnixNano(), fi.Size()))
+	}
+	http.ServeContent(rsp, c.Request(), path.Base(name), fi.ModTime(), content)
+	return nil
+}
+
+func fsError(err error) aicode.HTTPError {
+	if errors.Is(err, fs.ErrNotExist) || errors.Is(err, fs.ErrPermission) || errors.Is(err, fs.ErrInvalid) {
+		return aicode.ComNotExist
+	}
+	return aicode.ComInnerError
+}
+
+// acceptsEncoding reports whether the Accept-Encoding header value accepts
+// encoding with a non-zero quality.
+func acceptsEncoding(accept, encoding string) bool {
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		if coding := strings.TrimSpace(params[0]); coding != encoding && coding != "*" {
+			continue
+		}
+		for _, p := range params[1:] {
+			if q := strings.TrimSpace(p); q == "q=0" || strings.HasPrefix(q, "q=0.0") && strings.Trim(q[4:], "0") == "" {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
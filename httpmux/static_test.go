@@ -0,0 +1,63 @@
+package httpmux
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"testing/fstest"
+)
+
+func Test_StaticFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":     {Data: []byte("home")},
+		"js/app.js":      {Data: []byte("plain")},
+		"js/app.js.gz":   {Data: []byte("gzipped")},
+		"docs/readme.md": {Data: []byte("0123456789")},
+	}
+	srv := New()
+	srv.StaticWithConfig("/assets", StaticConfig{FS: fsys, Precompressed: true})
+
+	tests := []struct {
+		target   string
+		header   http.Header
+		status   int
+		body     string
+		encoding string
+	}{
+		{"/assets/", nil, http.StatusOK, "home", ""},
+		{"/assets/js/app.js", nil, http.StatusOK, "plain", ""},
+		{"/assets/js/app.js", http.Header{HeaderAcceptEncoding: {"br, gzip"}}, http.StatusOK, "gzipped", "gzip"},
+		{"/assets/js/app.js", http.Header{HeaderAcceptEncoding: {"gzip;q=0"}}, http.StatusOK, "plain", ""},
+		{"/assets/docs/readme.md", http.Header{"Range": {"bytes=2-4"}}, http.StatusPartialContent, "234", ""},
+		{"/assets/../static_test.go", nil, http.StatusNotFound, "", ""},
+		{"/assets/missing.txt", nil, http.StatusNotFound, "", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(GET, tt.target, nil)
+		for k, v := range tt.header {
+			req.Header[k] = v
+		}
+		rec := httptest.NewRecorder()
+		srv.ServeHTTP(rec, req)
+		if rec.Code != tt.status {
+			t.Errorf("%s: status %d, want %d", tt.target, rec.Code, tt.status)
+			continue
+		}
+		if tt.body != "" && rec.Body.String() != tt.body {
+			t.Errorf("%s: body %q, want %q", tt.target, rec.Body.String(), tt.body)
+		}
+		if got := rec.Header().Get(HeaderContentEncoding); got != tt.encoding {
+			t.Errorf("%s: encoding %q, want %q", tt.target, got, tt.encoding)
+		}
+	}
+
+	req := httptest.NewRequest(GET, "/assets/docs/readme.md", nil)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	req.Header.Set("If-None-Match", rec.Header().Get(HeaderETag))
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, req)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("etag revalidation status %d", rec.Code)
+	}
+}
@@ -0,0 +1,136 @@
+package httpmux
+
+import (
+	"aicode"
+	"bytes"
+	stdContext "context"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type (
+	// TimeoutConfig defines the config for Timeout middleware.
+	TimeoutConfig struct {
+		// Timeout is how long the next handle may run.
+		Timeout time.Duration
+
+		// Error is returned when the handle timed out.
+		// Default is aicode.ComTimeout, sent with status 503.
+		Error aicode.HTTPError
+	}
+
+	// timeoutWriter buffers the response of a handle running under Timeout.
+	// Once the timeout fired every write fails, so a late handle can't write
+	// to the client.
+	timeoutWriter struct {
+		mu       sync.Mutex
+		h        http.Header
+		buf      bytes.Buffer
+		code     int
+		timedOut bool
+	}
+)
+
+// Timeout returns a middleware which cancels the request context after d and
+// answers with aicode.ComTimeout if the next handle did not return by then.
+// Requests canceled by the client before that end with aicode.ComCanceled,
+// sent with StatusClientClosedRequest.
+func Timeout(d time.Duration) Middleware {
+	return TimeoutWithConfig(TimeoutConfig{Timeout: d})
+}
+
+// TimeoutWithConfig returns a Timeout middleware with config.
+//
+// The next handle runs in its own goroutine on a copy of the Context whose
+// response is buffered, so it is not suited to streaming responses. Handles
+// should pass Context.Context to blocking calls, e.g. gRPC requests, to stop
+// working once the deadline passed.
+func TimeoutWithConfig(config TimeoutConfig) Middleware {
+	if config.Error == nil {
+		config.Error = aicode.ComTimeout
+	}
+	return func(next Handle) Handle {
+		return func(c Context) aicode.HTTPError {
+			cc, ok := c.(*context)
+			if !ok || config.Timeout <= 0 {
+				return next(c)
+			}
+			ctx, cancel := stdContext.WithTimeout(cc.request.Context(), config.Timeout)
+			defer cancel()
+
+			tw := &timeoutWriter{h: make(http.Header)}
+			hc := cc.clone(cc.request.WithContext(ctx), tw)
+			done := make(chan aicode.HTTPError, 1)
+			panicked := make(chan interface{}, 1)
+			go func() {
+				defer func() {
+					if rc := recover(); rc != nil {
+						if rc != http.ErrAbortHandler {
+							rc = &panicError{value: rc, stack: debug.Stack()}
+						}
+						panicked <- rc
+					}
+				}()
+				done <- next(hc)
+			}()
+
+			select {
+			case rc := <-panicked:
+				panic(rc)
+			case err := <-done:
+				tw.mu.Lock()
+				defer tw.mu.Unlock()
+				for k, v := range hc.store {
+					c.Set(k, v)
+				}
+				rsp := c.Response()
+				for k, v := range tw.h {
+					rsp.Header()[k] = v
+				}
+				if tw.code != 0 {
+					rsp.WriteHeader(tw.code)
+					rsp.Write(tw.buf.Bytes())
+				}
+				return err
+			case <-ctx.Done():
+				tw.mu.Lock()
+				tw.timedOut = true
+				tw.mu.Unlock()
+				if cc.request.Context().Err() == stdContext.Canceled {
+					return aicode.ComCanceled
+				}
+				return config.Error
+			}
+		}
+	}
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.code != 0 {
+		return
+	}
+	tw.code = code
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if tw.code == 0 {
+		tw.code = http.StatusOK
+	}
+	return tw.buf.Write(b)
+}
+
+// Flush is a no-op, the response is sent when the handle returns.
+func (tw *timeoutWriter) Flush() {}
@@ -0,0 +1,66 @@
+package httpmux
+
+import (
+	"aicode"
+	stdContext "context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_Timeout(t *testing.T) {
+	late := make(chan error, 1)
+	srv := New()
+	srv.Use(Timeout(50 * time.Millisecond))
+	srv.GET("/fast", func(c Context) aicode.HTTPError {
+		c.Response().Header().Set("X-Done", "1")
+		c.String(http.StatusCreated, "fast")
+		return nil
+	})
+	srv.GET("/slow", func(c Context) aicode.HTTPError {
+		if _, ok := c.Context().Deadline(); !ok {
+			t.Error("no deadline on request context")
+		}
+		<-c.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		late <- c.String(http.StatusOK, "late")
+		return nil
+	})
+
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/fast", nil))
+	if rec.Code != http.StatusCreated || rec.Body.String() != "fast" || rec.Header().Get("X-Done") != "1" {
+		t.Errorf("fast: status %d body %q", rec.Code, rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/slow", nil))
+	if rec.Code != http.StatusServiceUnavailable || !strings.Contains(rec.Body.String(), "90013") {
+		t.Errorf("slow: status %d body %q", rec.Code, rec.Body.String())
+	}
+	if err := <-late; err != http.ErrHandlerTimeout {
+		t.Errorf("late write error %v", err)
+	}
+	if strings.Contains(rec.Body.String(), "late") {
+		t.Errorf("late write reached the client: %q", rec.Body.String())
+	}
+}
+
+func Test_TimeoutCanceled(t *testing.T) {
+	srv := New()
+	srv.Use(Timeout(time.Second))
+	srv.GET("/wait", func(c Context) aicode.HTTPError {
+		<-c.Context().Done()
+		return nil
+	})
+
+	ctx, cancel := stdContext.WithCancel(stdContext.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+	rec := httptest.NewRecorder()
+	srv.ServeHTTP(rec, httptest.NewRequest(GET, "/wait", nil).WithContext(ctx))
+	if rec.Code != StatusClientClosedRequest || !strings.Contains(rec.Body.String(), "90014") {
+		t.Errorf("canceled: status %d body %q", rec.Code, rec.Body.String())
+	}
+}
@@ -0,0 +1,264 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// WebSocket message types
+const (
+	TextMessage   = websocket.TextMessage
+	BinaryMessage = websocket.BinaryMessage
+)
+
+// WebSocket close codes
+const (
+	CloseNormalClosure   = websocket.CloseNormalClosure
+	CloseGoingAway       = websocket.CloseGoingAway
+	CloseMessageTooBig   = websocket.CloseMessageTooBig
+	CloseInternalErr     = websocket.CloseInternalServerErr
+	ClosePolicyViolation = websocket.ClosePolicyViolation
+)
+
+type (
+	// WebSocketConfig defines how Context.WebSocket upgrades connections.
+	WebSocketConfig struct {
+		// ReadBufferSize and WriteBufferSize are the I/O buffer sizes in bytes.
+		// Default is 4096.
+		ReadBufferSize  int
+		WriteBufferSize int
+
+		// MaxMessageSize is the largest message in bytes read from the peer; the
+		// connection is closed with CloseMessageTooBig beyond it.
+		// Default is 1 MB.
+		MaxMessageSize int64
+
+		// PingInterval is how often pings are sent to the peer. A connection
+		// whose peer did not answer for two intervals fails on read.
+		// Default is 30 seconds.
+		PingInterval time.Duration
+
+		// WriteTimeout bounds every write, including control frames.
+		// Default is 10 seconds.
+		WriteTimeout time.Duration
+
+		// AllowOrigins lists the origins allowed to connect, with the same
+		// wildcards as CORSConfig.AllowOrigins. When both AllowOrigins and
+		// CheckOrigin are empty, only same-host origins are allowed.
+		AllowOrigins []string
+
+		// CheckOrigin decides whether the request origin may connect. It is
+		// consulted when no entry of AllowOrigins matches.
+		CheckOrigin func(r *http.Request) bool
+
+		// Subprotocols lists the supported subprotocols, preferred first.
+		Subprotocols []string
+	}
+
+	// WebSocketConn is an upgraded WebSocket connection. One goroutine may read
+	// while others write; pings are answered by the reading goroutine, so a
+	// connection must be read for keepalive to work.
+	WebSocketConn struct {
+		conn      *websocket.Conn
+		config    WebSocketConfig
+		readMu    sync.Mutex
+		writeMu   sync.Mutex
+		closeOnce sync.Once
+		done      chan struct{}
+	}
+)
+
+// DefaultWebSocketConfig is the default WebSocket config of a server.
+var DefaultWebSocketConfig = WebSocketConfig{
+	ReadBufferSize:  4096,
+	WriteBufferSize: 4096,
+	MaxMessageSize:  1 << 20,
+	PingInterval:    30 * time.Second,
+	WriteTimeout:    10 * time.Second,
+}
+
+func (config WebSocketConfig) withDefaults() WebSocketConfig {
+	if config.ReadBufferSize == 0 {
+		config.ReadBufferSize = DefaultWebSocketConfig.ReadBufferSize
+	}
+	if config.WriteBufferSize == 0 {
+		config.WriteBufferSize = DefaultWebSocketConfig.WriteBufferSize
+	}
+	if config.MaxMessageSize == 0 {
+		config.MaxMessageSize = DefaultWebSocketConfig.MaxMessageSize
+	}
+	if config.PingInterval == 0 {
+		config.PingInterval = DefaultWebSocketConfig.PingInterval
+	}
+	if config.WriteTimeout == 0 {
+		config.WriteTimeout = DefaultWebSocketConfig.WriteTimeout
+	}
+	return config
+}
+
+func (c *context) WebSocket() (*WebSocketConn, error) {
+	config := c.mux.WebSocket.withDefaults()
+	upgrader := websocket.Upgrader{
+		ReadBufferSize:  config.ReadBufferSize,
+		WriteBufferSize: config.WriteBufferSize,
+		Subprotocols:    config.Subprotocols,
+		Error: func(w http.ResponseWriter, r *http.Request, status int, reason error) {
+			if status == http.StatusForbidden {
+				c.Error(aicode.ComAuthFailed)
+				return
+			}
+			c.Error(badParam("%v", reason))
+		},
+	}
+	if len(config.AllowOrigins) > 0 || config.CheckOrigin != nil {
+		cors := CORSConfig{AllowOrigins: config.AllowOrigins}
+		upgrader.CheckOrigin = func(r *http.Request) bool {
+			origin := r.Header.Get(HeaderOrigin)
+			if origin != "" && cors.allowOrigin(origin) != "" {
+				return true
+			}
+			return config.CheckOrigin != nil && config.CheckOrigin(r)
+		}
+	}
+
+	conn, err := upgrader.Upgrade(c.response, c.request, nil)
+	if err != nil {
+		return nil, err
+	}
+	c.response.Status = http.StatusSwitchingProtocols
+	c.response.Committed = true
+
+	ws := &WebSocketConn{conn: conn, config: config, done: make(chan struct{})}
+	pongWait := 2 * config.PingInterval
+	conn.SetReadLimit(config.MaxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+	go ws.keepalive()
+	return ws, nil
+}
+
+// keepalive pings the peer until the connection is closed.
+func (ws *WebSocketConn) keepalive() {
+	ticker := time.NewTicker(ws.config.PingInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ws.done:
+			return
+		case <-ticker.C:
+			deadline := time.Now().Add(ws.config.WriteTimeout)
+			if err := ws.conn.WriteControl(websocket.PingMessage, nil, deadline); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// Subprotocol returns the negotiated subprotocol.
+func (ws *WebSocketConn) Subprotocol() string {
+	return ws.conn.Subprotocol()
+}
+
+// ReadMessage reads the next message and returns its type, TextMessage or
+// BinaryMessage. A close from the peer is returned as an error for which
+// IsWebSocketClose reports true.
+func (ws *WebSocketConn) ReadMessage() (messageType int, data []byte, err error) {
+	ws.readMu.Lock()
+	defer ws.readMu.Unlock()
+	return ws.conn.ReadMessage()
+}
+
+// ReadText reads the next message as text.
+func (ws *WebSocketConn) ReadText() (string, error) {
+	_, b, err := ws.ReadMessage()
+	return string(b), err
+}
+
+// ReadJSON reads the next message and decodes it as JSON into v.
+func (ws *WebSocketConn) ReadJSON(v interface{}) error {
+	ws.readMu.Lock()
+	defer ws.readMu.Unlock()
+	return ws.conn.ReadJSON(v)
+}
+
+// WriteMessage writes a message of type TextMessage or BinaryMessage.
+func (ws *WebSocketConn) WriteMessage(messageType int, data []byte) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(ws.config.WriteTimeout))
+	return ws.conn.WriteMessage(messageType, data)
+}
+
+// WriteText writes a text message.
+func (ws *WebSocketConn) WriteText(s string) error {
+	return ws.WriteMessage(TextMessage, []byte(s))
+}
+
+// WriteBinary writes a binary message.
+func (ws *WebSocketConn) WriteBinary(b []byte) error {
+	return ws.WriteMessage(BinaryMessage, b)
+}
+
+// WriteJSON writes v encoded as JSON in a text message.
+func (ws *WebSocketConn) WriteJSON(v interface{}) error {
+	ws.writeMu.Lock()
+	defer ws.writeMu.Unlock()
+	ws.conn.SetWriteDeadline(time.Now().Add(ws.config.WriteTimeout))
+	return ws.conn.WriteJSON(v)
+}
+
+// Close closes the connection with CloseNormalClosure. See CloseWithReason.
+func (ws *WebSocketConn) Close() error {
+	return ws.CloseWithReason(CloseNormalClosure, "")
+}
+
+// CloseWithReason performs the close handshake: it sends a close frame with
+// code and reason, waits up to WriteTimeout for the peer to answer, then
+// closes the connection. A pending read returns once the peer answered.
+func (ws *WebSocketConn) CloseWithReason(code int, reason string) error {
+	err := websocket.ErrCloseSent
+	ws.closeOnce.Do(func() {
+		close(ws.done)
+		deadline := time.Now().Add(ws.config.WriteTimeout)
+		err = ws.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), deadline)
+		if err == nil {
+			ws.conn.SetReadDeadline(deadline)
+			ws.readMu.Lock()
+			for {
+				if _, _, rerr := ws.conn.NextReader(); rerr != nil {
+					break
+				}
+			}
+			ws.readMu.Unlock()
+		}
+		if cerr := ws.conn.Close(); err == nil {
+			err = cerr
+		}
+	})
+	return err
+}
+
+// IsWebSocketClose reports whether err was returned by a read because the
+// peer closed the connection with one of codes, or with any code when codes
+// is empty.
+func IsWebSocketClose(err error, codes ...int) bool {
+	ce, ok := err.(*websocket.CloseError)
+	if !ok {
+		return false
+	}
+	if len(codes) == 0 {
+		return true
+	}
+	for _, code := range codes {
+		if ce.Code == code {
+			return true
+		}
+	}
+	return false
+}
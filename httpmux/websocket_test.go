@@ -0,0 +1,60 @@
+package httpmux
+
+import (
+	"aicode"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func Test_WebSocket(t *testing.T) {
+	srv := New()
+	srv.WebSocket.AllowOrigins = []string{"https://*.example.com"}
+	srv.WebSocket.MaxMessageSize = 64
+	closed := make(chan error, 1)
+	srv.GET("/ws", func(c Context) aicode.HTTPError {
+		ws, err := c.WebSocket()
+		if err != nil {
+			return nil
+		}
+		defer ws.Close()
+		for {
+			var msg map[string]string
+			if err := ws.ReadJSON(&msg); err != nil {
+				closed <- err
+				return nil
+			}
+			ws.WriteJSON(map[string]string{"echo": msg["text"]})
+		}
+	})
+	ts := httptest.NewServer(srv)
+	defer ts.Close()
+	url := "ws" + strings.TrimPrefix(ts.URL, "http") + "/ws"
+
+	_, rsp, err := websocket.DefaultDialer.Dial(url, http.Header{HeaderOrigin: {"https://evil.com"}})
+	if err == nil || rsp.StatusCode != http.StatusForbidden {
+		t.Fatalf("foreign origin: %v", err)
+	}
+
+	conn, _, err := websocket.DefaultDialer.Dial(url, http.Header{HeaderOrigin: {"https://app.example.com"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.WriteJSON(map[string]string{"text": "hello"})
+	var reply map[string]string
+	if err := conn.ReadJSON(&reply); err != nil || reply["echo"] != "hello" {
+		t.Fatalf("reply %v, %v", reply, err)
+	}
+
+	conn.WriteMessage(websocket.TextMessage, []byte(strings.Repeat("x", 100)))
+	if err := <-closed; !IsWebSocketClose(err) && !strings.Contains(err.Error(), "read limit") {
+		t.Errorf("oversized message error %v", err)
+	}
+	if _, _, err := conn.ReadMessage(); !websocket.IsCloseError(err, websocket.CloseMessageTooBig, websocket.CloseNormalClosure) {
+		t.Errorf("client close %v", err)
+	}
+}